@@ -0,0 +1,179 @@
+package quill
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Number is any type CounterPermission can add together
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Permission that must be created by the command before it's submitted, as
+// it needs more than the source's data to be populated
+type presetPermission interface {
+	Permission
+
+	// Reports whether the command set the permission up correctly
+	validate() error
+}
+
+// Interprets the value as a field of type T that accumulators can merge
+// into. Other accumulators may be merging into the field, so only its type is
+// looked at.
+func accumulatorTarget[T any](val reflect.Value) (reflect.Value, error) {
+	expected := reflect.TypeOf((*T)(nil)).Elem()
+	if !val.IsValid() || val.Type() != expected {
+		return reflect.Value{}, fmt.Errorf("can not populate an accumulator of %s with a value that is not one", expected)
+	}
+	if !val.CanSet() {
+		return reflect.Value{}, fmt.Errorf("can not populate an accumulator with a value that can not be assigned to")
+	}
+	return val, nil
+}
+
+// CounterPermission grants a command the ability to add to a number within
+// the source, without being able to see its value. Commands counting into
+// the same field are free to run in parallel, with each command's total
+// added to the source once it has finished.
+type CounterPermission[T Number] struct {
+	delta  T
+	target reflect.Value
+}
+
+// Adds the delta to the command's total
+func (cp *CounterPermission[T]) Add(delta T) {
+	cp.delta += delta
+}
+
+// Total added by the command so far
+func (cp CounterPermission[T]) Delta() T {
+	return cp.delta
+}
+
+func (cp *CounterPermission[T]) inject(val reflect.Value) error {
+	target, err := accumulatorTarget[T](val)
+	if err != nil {
+		return err
+	}
+	cp.delta = 0
+	cp.target = target
+	return nil
+}
+
+func (cp *CounterPermission[T]) clear() {
+	cp.delta = 0
+	cp.target = reflect.Value{}
+}
+
+func (cp *CounterPermission[T]) written() bool {
+	return cp.delta != 0
+}
+
+func (cp *CounterPermission[T]) apply() {
+	if cp.delta == 0 {
+		return
+	}
+	current := cp.target.Interface().(T)
+	cp.target.Set(reflect.ValueOf(current + cp.delta))
+}
+
+func (cp CounterPermission[T]) Type() PermissionType {
+	return AccumulatePermissionType
+}
+
+// AccumulatorPermission grants a command the ability to contribute deltas to
+// a field within the source, combined with the field's value by a merge
+// function once the command has finished. Commands accumulating into the
+// same field are free to run in parallel, so the merge function should give
+// the same result regardless of the order deltas are merged in.
+//
+// The permission must be created before the command is submitted, by setting
+// the view's field through the command's View method:
+//
+//	command := &quill.ViewCommand[StatsView]{Action: ...}
+//	command.View().Max = quill.NewAccumulatorPermission(func(current, delta float64) float64 {
+//		return math.Max(current, delta)
+//	})
+type AccumulatorPermission[T any] struct {
+	merge  func(current, delta T) T
+	deltas []T
+	target reflect.Value
+
+	// Result of merging the deltas into the source's value, worked out
+	// before anything is stored in case the merge function panics
+	merged T
+}
+
+// Creates an accumulator that combines each delta with the source's value
+// using the merge function provided.
+func NewAccumulatorPermission[T any](merge func(current, delta T) T) *AccumulatorPermission[T] {
+	return &AccumulatorPermission[T]{
+		merge: merge,
+	}
+}
+
+// Queues the delta to be merged into the source once the command has
+// finished
+func (ap *AccumulatorPermission[T]) Add(delta T) {
+	ap.deltas = append(ap.deltas, delta)
+}
+
+// Deltas added by the command so far, in the order they were added
+func (ap AccumulatorPermission[T]) Deltas() []T {
+	return ap.deltas
+}
+
+func (ap *AccumulatorPermission[T]) validate() error {
+	if ap.merge == nil {
+		return fmt.Errorf("accumulator has no merge function")
+	}
+	return nil
+}
+
+func (ap *AccumulatorPermission[T]) inject(val reflect.Value) error {
+	target, err := accumulatorTarget[T](val)
+	if err != nil {
+		return err
+	}
+	ap.deltas = nil
+	ap.target = target
+	return nil
+}
+
+// Clears the data populated, keeping the merge function
+func (ap *AccumulatorPermission[T]) clear() {
+	var merged T
+	ap.deltas = nil
+	ap.target = reflect.Value{}
+	ap.merged = merged
+}
+
+func (ap *AccumulatorPermission[T]) written() bool {
+	return len(ap.deltas) > 0
+}
+
+func (ap *AccumulatorPermission[T]) prepare() {
+	if len(ap.deltas) == 0 {
+		return
+	}
+	current := ap.target.Interface().(T)
+	for _, delta := range ap.deltas {
+		current = ap.merge(current, delta)
+	}
+	ap.merged = current
+}
+
+func (ap *AccumulatorPermission[T]) apply() {
+	if len(ap.deltas) == 0 {
+		return
+	}
+	ap.target.Set(reflect.ValueOf(&ap.merged).Elem())
+}
+
+func (ap AccumulatorPermission[T]) Type() PermissionType {
+	return AccumulatePermissionType
+}
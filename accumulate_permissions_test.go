@@ -0,0 +1,282 @@
+package quill_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+type StatsData struct {
+	Count   int
+	Total   float64
+	Max     float64
+	Buckets map[string]int
+}
+
+type CountView struct {
+	Count *quill.CounterPermission[int]
+	Total *quill.CounterPermission[float64]
+}
+
+type MaxView struct {
+	Max *quill.AccumulatorPermission[float64]
+}
+
+func TestCounterPermission_CountersShareField(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &StatsData{Count: 10}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	firstStarted := make(chan struct{})
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[CountView]{
+			Action: func(view *CountView) error {
+				close(firstStarted)
+				view.Count.Add(2)
+				view.Total.Add(0.5)
+				return nil
+			},
+		},
+		// Only starts once the first counter has, which only ever happens if
+		// both are running at the same time
+		&quill.ViewCommand[CountView]{
+			Action: func(view *CountView) error {
+				select {
+				case <-firstStarted:
+				case <-time.After(time.Second):
+					return assert.AnError
+				}
+				view.Count.Add(3)
+				view.Count.Add(-1)
+				view.Total.Add(1.5)
+				return nil
+			},
+		},
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, 14, data.Count)
+	assert.Equal(t, 2., data.Total)
+}
+
+func TestCounterPermission_ReaderSeesTotal(t *testing.T) {
+	// ARRANGE ================================================================
+	type ReadCountView struct {
+		Count *quill.ItemReadPermission[int]
+	}
+	data := &StatsData{}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	commands := make([]quill.Command, 0)
+	for i := 0; i < 100; i++ {
+		commands = append(commands, &quill.ViewCommand[CountView]{
+			Action: func(view *CountView) error {
+				view.Count.Add(1)
+				return nil
+			},
+		})
+	}
+	count := 0
+	commands = append(commands, &quill.ViewCommand[ReadCountView]{
+		Action: func(view *ReadCountView) error {
+			count = view.Count.Value()
+			return nil
+		},
+	})
+
+	// ACT ====================================================================
+	err := quill.WaitAll(dataSource.Run(commands...)...)
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, 100, count)
+}
+
+func TestCounterPermission_PopulateView(t *testing.T) {
+	// ARRANGE ================================================================
+	data := StatsData{Count: 1}
+	view := CountView{}
+
+	// ACT ====================================================================
+	changes, err := quill.PopulateView(&data, &view)
+	view.Count.Add(4)
+	delta := view.Count.Delta()
+	changes.Apply()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, 4, delta)
+	assert.Equal(t, 5, data.Count)
+}
+
+func TestCounterPermission_MismatchedTypes(t *testing.T) {
+	tests := map[string]struct {
+		view any
+	}{
+		"int counter on float": {
+			view: &struct {
+				Total *quill.CounterPermission[int]
+			}{},
+		},
+		"counter on map entry": {
+			view: &struct {
+				Buckets struct {
+					Low *quill.CounterPermission[int]
+				}
+			}{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			data := StatsData{Buckets: map[string]int{"Low": 1}}
+
+			// ACT ============================================================
+			_, err := quill.PopulateView(&data, tc.view)
+
+			// ASSERT =========================================================
+			var viewErr quill.ViewError
+			assert.ErrorAs(t, err, &viewErr)
+		})
+	}
+}
+
+func TestAccumulatorPermission(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &StatsData{Max: 3}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	commands := make([]quill.Command, 0)
+	for _, values := range [][]float64{{1, 7, 2}, {5}, {9, 4}, {}} {
+		values := values
+		command := &quill.ViewCommand[MaxView]{
+			Action: func(view *MaxView) error {
+				for _, v := range values {
+					view.Max.Add(v)
+				}
+				return nil
+			},
+		}
+		command.View().Max = quill.NewAccumulatorPermission(math.Max)
+		commands = append(commands, command)
+	}
+
+	// ACT ====================================================================
+	err := quill.WaitAll(dataSource.Run(commands...)...)
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, 9., data.Max)
+}
+
+func TestAccumulatorPermission_NotSetUp(t *testing.T) {
+	tests := map[string]struct {
+		accumulator *quill.AccumulatorPermission[float64]
+	}{
+		"never created": {
+			accumulator: nil,
+		},
+		"no merge function": {
+			accumulator: quill.NewAccumulatorPermission[float64](nil),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			dataSource := quill.NewDataSource(StatsData{})
+			command := &quill.ViewCommand[MaxView]{
+				Action: func(view *MaxView) error {
+					return nil
+				},
+			}
+			command.View().Max = tc.accumulator
+
+			// ACT ============================================================
+			err := dataSource.Submit(command).Wait()
+
+			// ASSERT =========================================================
+			var viewErr quill.ViewError
+			if assert.ErrorAs(t, err, &viewErr) {
+				assert.Equal(t, ".Max", viewErr.Path)
+			}
+			dataSource.Close()
+		})
+	}
+}
+
+func TestAccumulatorPermission_MergePanics(t *testing.T) {
+	// ARRANGE ================================================================
+	type MaxAndCountView struct {
+		Count *quill.CounterPermission[int]
+		Max   *quill.AccumulatorPermission[float64]
+	}
+
+	newCommand := func() *quill.ViewCommand[MaxAndCountView] {
+		command := &quill.ViewCommand[MaxAndCountView]{
+			Action: func(view *MaxAndCountView) error {
+				view.Count.Add(1)
+				view.Max.Add(100)
+				return nil
+			},
+		}
+		command.View().Max = quill.NewAccumulatorPermission(func(current, delta float64) float64 {
+			panic("oh no")
+		})
+		return command
+	}
+
+	t.Run("data source", func(t *testing.T) {
+		data := &StatsData{Count: 1, Max: 5}
+		dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+		// ACT ================================================================
+		err := dataSource.Submit(newCommand()).Wait()
+		dataSource.Close()
+
+		// ASSERT =============================================================
+		var panicErr quill.PanicError
+		if assert.ErrorAs(t, err, &panicErr) {
+			assert.Equal(t, "oh no", panicErr.Value)
+		}
+		assert.Equal(t, 1, data.Count)
+		assert.Equal(t, 5., data.Max)
+	})
+
+	t.Run("run sequentially", func(t *testing.T) {
+		data := &StatsData{Count: 1, Max: 5}
+		dataSource := quill.NewDataSource(data)
+
+		// ACT ================================================================
+		err := dataSource.RunSequentially(newCommand())
+		dataSource.Close()
+
+		// ASSERT =============================================================
+		var panicErr quill.PanicError
+		assert.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, 1, data.Count)
+		assert.Equal(t, 5., data.Max)
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		data := &StatsData{Count: 1, Max: 5}
+		dataSource := quill.NewDataSource(data)
+
+		// ACT ================================================================
+		err := dataSource.SubmitTransaction(newCommand()).Wait()
+		dataSource.Close()
+
+		// ASSERT =============================================================
+		var panicErr quill.PanicError
+		assert.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, 1, data.Count)
+		assert.Equal(t, 5., data.Max)
+	})
+}
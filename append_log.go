@@ -0,0 +1,63 @@
+package quill
+
+import "sync"
+
+// Place held by a command in the order appends to a path are committed
+type appendEntry struct {
+	resolved bool
+
+	// Appends the command's elements to the source, nil if the command had
+	// nothing to append
+	commit func()
+}
+
+// Commits the appends made to each path in the order the appenders were
+// granted the path. Appenders finishing early have their elements held onto
+// until everyone granted the path before them has finished.
+//
+// Elements are only ever committed by an appender that still holds the path,
+// so nothing else can be reading or writing the slice at the time.
+type appendLog struct {
+	lock    sync.Mutex
+	entries map[string][]*appendEntry
+}
+
+func newAppendLog() *appendLog {
+	return &appendLog{
+		entries: make(map[string][]*appendEntry),
+	}
+}
+
+// Reserves the next place in line for committing appends to the path
+func (al *appendLog) register(path string) *appendEntry {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+	entry := &appendEntry{}
+	al.entries[path] = append(al.entries[path], entry)
+	return entry
+}
+
+// Marks the entry as finished, committing every finished entry at the front
+// of the line.
+func (al *appendLog) resolve(path string, entry *appendEntry, commit func()) {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+
+	entry.resolved = true
+	entry.commit = commit
+
+	entries := al.entries[path]
+	for len(entries) > 0 && entries[0].resolved {
+		if entries[0].commit != nil {
+			entries[0].commit()
+		}
+		entries[0] = nil
+		entries = entries[1:]
+	}
+
+	if len(entries) == 0 {
+		delete(al.entries, path)
+		return
+	}
+	al.entries[path] = entries
+}
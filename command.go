@@ -1,7 +1,10 @@
 package quill
 
+import "context"
+
 type Command interface {
 	Run() error
+	run(ctx context.Context) error
 	data() any
 }
 
@@ -14,6 +17,41 @@ func (vc *ViewCommand[T]) Run() error {
 	return vc.Action(&vc.populatedData)
 }
 
+func (vc *ViewCommand[T]) run(ctx context.Context) error {
+	return vc.Run()
+}
+
 func (vc *ViewCommand[T]) data() any {
 	return &vc.populatedData
 }
+
+// View the command's action is ran with. Permissions that need setting up
+// before the command is submitted, such as MapKeys, are set on the view
+// returned.
+func (vc *ViewCommand[T]) View() *T {
+	return &vc.populatedData
+}
+
+// ContextCommand is a ViewCommand whose action receives the context the
+// command was submitted with.
+type ContextCommand[T any] struct {
+	populatedData T
+	Action        func(context.Context, *T) error
+}
+
+func (cc *ContextCommand[T]) Run() error {
+	return cc.run(context.Background())
+}
+
+func (cc *ContextCommand[T]) run(ctx context.Context) error {
+	return cc.Action(ctx, &cc.populatedData)
+}
+
+func (cc *ContextCommand[T]) data() any {
+	return &cc.populatedData
+}
+
+// Same as ViewCommand's View.
+func (cc *ContextCommand[T]) View() *T {
+	return &cc.populatedData
+}
@@ -0,0 +1,93 @@
+package quill
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDependencyCycle is returned when submitting a command graph in which a
+// command is ordered after itself, either directly or through other commands.
+var ErrDependencyCycle = errors.New("command graph contains a cycle")
+
+// CommandGraph is a set of commands along with explicit orderings between
+// them, for when a command has to run after another even though their views
+// don't touch the same data. Commands whose views do overlap are still
+// ordered by the data source as usual.
+type CommandGraph struct {
+	nodes []*GraphNode
+}
+
+// GraphNode is a command added to a CommandGraph
+type GraphNode struct {
+	graph   *CommandGraph
+	index   int
+	command Command
+	after   []*GraphNode
+}
+
+func NewCommandGraph() *CommandGraph {
+	return &CommandGraph{}
+}
+
+// Adds the command to the graph, returning the node used for ordering it
+// relative to the graph's other commands.
+func (cg *CommandGraph) Add(command Command) *GraphNode {
+	node := &GraphNode{
+		graph:   cg,
+		index:   len(cg.nodes),
+		command: command,
+	}
+	cg.nodes = append(cg.nodes, node)
+	return node
+}
+
+// Orders the command to only start once every command provided has finished
+// successfully. If any of them fail, the command is skipped.
+func (gn *GraphNode) After(nodes ...*GraphNode) *GraphNode {
+	gn.after = append(gn.after, nodes...)
+	return gn
+}
+
+// Order the graph's commands can be submitted in such that every command
+// comes after the commands it depends on. Commands are otherwise kept in the
+// order they were added.
+func (cg *CommandGraph) topologicalOrder() ([]*GraphNode, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(cg.nodes))
+	order := make([]*GraphNode, 0, len(cg.nodes))
+
+	var visit func(node *GraphNode) error
+	visit = func(node *GraphNode) error {
+		switch state[node.index] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: command %d depends on itself", ErrDependencyCycle, node.index)
+		}
+
+		state[node.index] = visiting
+		for _, dependency := range node.after {
+			if dependency.graph != cg {
+				return fmt.Errorf("command %d depends on a command from another graph", node.index)
+			}
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[node.index] = visited
+		order = append(order, node)
+		return nil
+	}
+
+	for _, node := range cg.nodes {
+		if err := visit(node); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
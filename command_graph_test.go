@@ -0,0 +1,229 @@
+package quill_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+type FloatArrReadView struct {
+	FloatArr *quill.ArrayReadPermission[float64]
+}
+
+// Records the order commands ran in
+type runLog struct {
+	lock sync.Mutex
+	ran  []string
+}
+
+func (rl *runLog) record(name string) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	rl.ran = append(rl.ran, name)
+}
+
+func (rl *runLog) index(name string) int {
+	for i, ran := range rl.ran {
+		if ran == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func loggedCommand(log *runLog, name string, delay time.Duration) *quill.ViewCommand[FloatArrReadView] {
+	return &quill.ViewCommand[FloatArrReadView]{
+		Action: func(view *FloatArrReadView) error {
+			time.Sleep(delay)
+			log.record(name)
+			return nil
+		},
+	}
+}
+
+func TestCommandGraph_RunsAfterDependencies(t *testing.T) {
+	// ARRANGE ================================================================
+	dataSource := quill.NewDataSource(NastyData{}, quill.WithPoolSize(4))
+	log := &runLog{}
+
+	// Every command only reads, so without the graph they'd all run at once
+	graph := quill.NewCommandGraph()
+	a := graph.Add(loggedCommand(log, "a", 20*time.Millisecond))
+	b := graph.Add(loggedCommand(log, "b", 10*time.Millisecond)).After(a)
+	c := graph.Add(loggedCommand(log, "c", 0)).After(a)
+	graph.Add(loggedCommand(log, "d", 0)).After(b, c)
+
+	// Added before the commands it depends on
+	e := graph.Add(loggedCommand(log, "e", 0))
+	a.After(e)
+
+	// ACT ====================================================================
+	futures, err := dataSource.SubmitGraph(graph)
+	waitErr := quill.WaitAll(futures...)
+	closeErr := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, waitErr)
+	assert.NoError(t, closeErr)
+	assert.Len(t, futures, 5)
+	assert.Len(t, log.ran, 5)
+	assert.Less(t, log.index("e"), log.index("a"))
+	assert.Less(t, log.index("a"), log.index("b"))
+	assert.Less(t, log.index("a"), log.index("c"))
+	assert.Less(t, log.index("b"), log.index("d"))
+	assert.Less(t, log.index("c"), log.index("d"))
+}
+
+func TestCommandGraph_Cycle(t *testing.T) {
+	tests := map[string]struct {
+		build func(graph *quill.CommandGraph, log *runLog)
+	}{
+		"self": {
+			build: func(graph *quill.CommandGraph, log *runLog) {
+				a := graph.Add(loggedCommand(log, "a", 0))
+				a.After(a)
+			},
+		},
+		"through other commands": {
+			build: func(graph *quill.CommandGraph, log *runLog) {
+				a := graph.Add(loggedCommand(log, "a", 0))
+				b := graph.Add(loggedCommand(log, "b", 0)).After(a)
+				c := graph.Add(loggedCommand(log, "c", 0)).After(b)
+				a.After(c)
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			dataSource := quill.NewDataSource(NastyData{})
+			log := &runLog{}
+			graph := quill.NewCommandGraph()
+			graph.Add(loggedCommand(log, "unrelated", 0))
+			tc.build(graph, log)
+
+			// ACT ============================================================
+			futures, err := dataSource.SubmitGraph(graph)
+			closeErr := dataSource.Close()
+
+			// ASSERT =========================================================
+			assert.ErrorIs(t, err, quill.ErrDependencyCycle)
+			assert.Nil(t, futures)
+			assert.NoError(t, closeErr)
+			assert.Empty(t, log.ran)
+		})
+	}
+}
+
+func TestCommandGraph_DependencyFromAnotherGraph(t *testing.T) {
+	// ARRANGE ================================================================
+	dataSource := quill.NewDataSource(NastyData{})
+	log := &runLog{}
+	other := quill.NewCommandGraph().Add(loggedCommand(log, "other", 0))
+	graph := quill.NewCommandGraph()
+	graph.Add(loggedCommand(log, "a", 0)).After(other)
+
+	// ACT ====================================================================
+	futures, err := dataSource.SubmitGraph(graph)
+	dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.Error(t, err)
+	assert.Nil(t, futures)
+	assert.Empty(t, log.ran)
+}
+
+func TestCommandGraph_DependencyFails(t *testing.T) {
+	// ARRANGE ================================================================
+	dataSource := quill.NewDataSource(NastyData{}, quill.WithPoolSize(4))
+	log := &runLog{}
+	failure := errors.New("something went wrong")
+
+	graph := quill.NewCommandGraph()
+	a := graph.Add(&quill.ViewCommand[FloatArrReadView]{
+		Action: func(view *FloatArrReadView) error {
+			return failure
+		},
+	})
+	b := graph.Add(loggedCommand(log, "b", 0)).After(a)
+	graph.Add(loggedCommand(log, "c", 0)).After(b)
+	graph.Add(loggedCommand(log, "d", 0))
+
+	// ACT ====================================================================
+	futures, err := dataSource.SubmitGraph(graph)
+	for _, future := range futures {
+		future.Wait()
+	}
+	closeErr := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.ErrorIs(t, futures[0].Err(), failure)
+	assert.ErrorIs(t, futures[1].Err(), quill.ErrCommandSkipped)
+	assert.ErrorIs(t, futures[2].Err(), quill.ErrCommandSkipped)
+	assert.NoError(t, futures[3].Err())
+	assert.Equal(t, []string{"d"}, log.ran)
+
+	// Only the command that actually failed is reported
+	assert.ErrorIs(t, closeErr, failure)
+	assert.NotErrorIs(t, closeErr, quill.ErrCommandSkipped)
+}
+
+func TestCommandGraph_WaitingCommandsDontBlockTheirDependencies(t *testing.T) {
+	// ARRANGE ================================================================
+	type StrArrWriteView struct {
+		StrArr *quill.ArrayWritePermission[string]
+	}
+
+	type ArraysWriteView struct {
+		FloatArr *quill.ArrayWritePermission[float64]
+		StrArr   *quill.ArrayWritePermission[string]
+	}
+
+	dataSource := quill.NewDataSource(
+		NastyData{},
+		quill.WithPoolSize(4),
+		quill.WithFairness(quill.WriterPreferred),
+	)
+	log := &runLog{}
+
+	// Readers wait on every writer in the window under WriterPreferred, so
+	// the reader would wait on the writer, which waits on the dependent ahead
+	// of it, which waits on the reader, if the dependent was held in the
+	// window
+	graph := quill.NewCommandGraph()
+	reader := graph.Add(loggedCommand(log, "reader", 10*time.Millisecond))
+	graph.Add(&quill.ViewCommand[StrArrWriteView]{
+		Action: func(view *StrArrWriteView) error {
+			log.record("dependent")
+			return nil
+		},
+	}).After(reader)
+	graph.Add(&quill.ViewCommand[ArraysWriteView]{
+		Action: func(view *ArraysWriteView) error {
+			log.record("writer")
+			return nil
+		},
+	})
+
+	// ACT ====================================================================
+	futures, err := dataSource.SubmitGraph(graph)
+	finished := quill.All(futures...)
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	select {
+	case <-finished.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("graph never finished")
+	}
+	assert.NoError(t, finished.Err())
+	assert.NoError(t, dataSource.Close())
+	assert.Less(t, log.index("reader"), log.index("dependent"))
+}
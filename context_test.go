@@ -0,0 +1,131 @@
+package quill_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataSource_RunContext_CancelRemovesPendingCommands(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	})
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := false
+
+	// ACT ====================================================================
+	futures := dataSource.RunContext(
+		ctx,
+		&quill.ContextCommand[WriteFloatArrView]{
+			Action: func(ctx context.Context, view *WriteFloatArrView) error {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+		&quill.ContextCommand[WriteFloatArrView]{
+			Action: func(ctx context.Context, view *WriteFloatArrView) error {
+				ran = true
+				return nil
+			},
+		},
+	)
+	<-started
+	cancel()
+	err := quill.WaitAll(futures...)
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, futures[0].Err(), context.Canceled)
+	assert.ErrorIs(t, futures[1].Err(), context.Canceled)
+	assert.False(t, ran)
+	assert.ErrorIs(t, dataSource.Close(), context.Canceled)
+}
+
+func TestDataSource_SubmitContext_AlreadyCancelled(t *testing.T) {
+	// ARRANGE ================================================================
+	type ReadFloatArrView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	}, quill.WithStopOnError())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// ACT ====================================================================
+	cancelled := dataSource.SubmitContext(ctx, &quill.ViewCommand[ReadFloatArrView]{
+		Action: func(view *ReadFloatArrView) error {
+			return nil
+		},
+	})
+	afterCancelled := dataSource.Submit(&quill.ViewCommand[ReadFloatArrView]{
+		Action: func(view *ReadFloatArrView) error {
+			return nil
+		},
+	})
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, cancelled.Wait(), context.Canceled)
+	assert.NoError(t, afterCancelled.Wait(), "cancellation should not halt the data source")
+	assert.ErrorIs(t, dataSource.Close(), context.Canceled)
+}
+
+func TestDataSource_SubmitContext_CancelledWhileSchedulerBusy(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	}, quill.WithSchedulingWindow(1))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	write := &quill.ViewCommand[WriteFloatArrView]{
+		Action: func(view *WriteFloatArrView) error {
+			return nil
+		},
+	}
+
+	// Hold the data so every following command queues up behind it, filling
+	// both the scheduling window and the scheduler's queue
+	blocker := dataSource.Submit(&quill.ViewCommand[WriteFloatArrView]{
+		Action: func(view *WriteFloatArrView) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+	<-started
+	queued := make([]*quill.Future, 0)
+	for i := 0; i < 11; i++ {
+		queued = append(queued, dataSource.Submit(write))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// ACT ====================================================================
+	cancelled := dataSource.SubmitContext(ctx, write)
+	cancelledTransaction := dataSource.SubmitTransactionContext(ctx, write, write)
+	cancelledErr := cancelled.Wait()
+	cancelledTransactionErr := cancelledTransaction.Wait()
+	close(release)
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, cancelledErr, context.Canceled)
+	assert.ErrorIs(t, cancelledTransactionErr, context.Canceled)
+	assert.NoError(t, blocker.Wait())
+	assert.NoError(t, quill.WaitAll(queued...))
+	assert.ErrorIs(t, dataSource.Close(), context.Canceled)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package quill_test
+
+import "time"
+
+// CPU time isn't tracked on this platform
+func processCPUTime() time.Duration {
+	return 0
+}
@@ -1,116 +1,303 @@
 package quill
 
 import (
+	"context"
+	"errors"
+	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type DataSource[T any] struct {
-	commandsToSchedule chan Command
-	data               T
+	commandsToSchedule chan *dataSourceWorkerJob
+	data               *T
 	wg                 *sync.WaitGroup
+	errs               *commandErrors
+	submitted          atomic.Int64
+	plans              *viewPlanCache
 }
 
-func NewDataSource[T any](data T) *DataSource[T] {
-	return NewDataSourceWithPoolSize[T](data, runtime.NumCPU())
+type DataSourceOption func(*dataSourceConfig)
+
+type dataSourceConfig struct {
+	poolSize      int
+	stopOnError   bool
+	window        int
+	fairness      FairnessPolicy
+	priorityAging time.Duration
 }
 
-func NewDataSourceWithPoolSize[T any](data T, pool int) *DataSource[T] {
-	c := make(chan Command, 10)
+// Number of goroutines available for running commands in parallel. Defaults
+// to the number of CPUs available.
+func WithPoolSize(pool int) DataSourceOption {
+	return func(dsc *dataSourceConfig) {
+		dsc.poolSize = pool
+	}
+}
+
+// Stops scheduling commands once any command returns an error. Commands that
+// have not started yet are skipped until the next call to Wait.
+func WithStopOnError() DataSourceOption {
+	return func(dsc *dataSourceConfig) {
+		dsc.stopOnError = true
+	}
+}
+
+// Maximum number of pending commands the scheduler looks through when finding
+// commands to run. Commands further back in the window may start before the
+// commands ahead of them as long as they don't touch any of the same data.
+// A window of 1 starts commands strictly in the order they were submitted.
+func WithSchedulingWindow(size int) DataSourceOption {
+	return func(dsc *dataSourceConfig) {
+		dsc.window = size
+	}
+}
+
+// Order in which pending commands touching the same data are started.
+// Defaults to FIFOFair.
+func WithFairness(policy FairnessPolicy) DataSourceOption {
+	return func(dsc *dataSourceConfig) {
+		dsc.fairness = policy
+	}
+}
+
+// How long a command has to wait on commands of a higher priority before its
+// own priority is raised by one, so that low priority commands are never
+// starved. Defaults to 100ms. Zero or less disables aging.
+func WithPriorityAging(interval time.Duration) DataSourceOption {
+	return func(dsc *dataSourceConfig) {
+		dsc.priorityAging = interval
+	}
+}
+
+func NewDataSource[T any](data T, options ...DataSourceOption) *DataSource[T] {
+	config := dataSourceConfig{
+		poolSize:      runtime.NumCPU(),
+		window:        128,
+		priorityAging: 100 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	c := make(chan *dataSourceWorkerJob, 10)
 	wg := &sync.WaitGroup{}
-	go dataSourceScheduler(data, wg, c, pool)
+	errs := &commandErrors{stopOnError: config.stopOnError}
+	// Keep our own copy of the data so that it's addressable, allowing
+	// commands to write back to it
+	source := &data
+	plans := &viewPlanCache{}
+	go newScheduler(reflect.ValueOf(source).Elem(), plans, wg, errs, config).run(c)
 	return &DataSource[T]{
-		data:               data,
+		data:               source,
+		plans:              plans,
 		commandsToSchedule: c,
 		wg:                 wg,
+		errs:               errs,
 	}
 }
 
-type dataSourceWorkerJob struct {
-	command     Command
-	commandData any
-	permissions map[string]PermissionType
+func NewDataSourceWithPoolSize[T any](data T, pool int) *DataSource[T] {
+	return NewDataSource(data, WithPoolSize(pool))
+}
+
+func (ds *DataSource[T]) nextIndex() int {
+	return int(ds.submitted.Add(1) - 1)
 }
 
-func dataSourceWorker(
-	index int,
-	permissionTable *PermissionTable,
-	wg *sync.WaitGroup,
-	sourceData any,
-	jobs <-chan *dataSourceWorkerJob,
-) {
-	// ctx, task := trace.NewTask(context.Background(), fmt.Sprintf("datasourceWorker-%d", index))
-	for job := range jobs {
-		applyChanges := PopulateView(sourceData, job.commandData)
-		// trace.WithRegion(ctx, "command", func() { job.command.Run() })
-		job.command.Run()
-		applyChanges.Apply()
-		permissionTable.Clear(job.permissions)
-		wg.Done()
+// Runs each command one after another on the calling goroutine, returning the
+// errors of all commands that failed.
+func (ds *DataSource[T]) RunSequentially(commands ...Command) error {
+	errs := make([]error, 0)
+	for _, c := range commands {
+		index := ds.nextIndex()
+		sourceValue := reflect.ValueOf(ds.data).Elem()
+		view := c.data()
+		plan, err := ds.plans.get(sourceValue.Type(), reflect.TypeOf(view))
+		if err != nil {
+			errs = append(errs, newCommandError(index, c, err))
+			continue
+		}
+
+		applyChanges, err := plan.populate(sourceValue, view)
+		if err != nil {
+			errs = append(errs, newCommandError(index, c, err))
+			continue
+		}
+
+		err = runRecovered(context.Background(), c)
+		var panicErr PanicError
+		if !errors.As(err, &panicErr) {
+			if prepareErr := prepareRecovered(applyChanges); prepareErr != nil {
+				err = prepareErr
+			} else {
+				applyChanges.store()
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, newCommandError(index, c, err))
+		}
 	}
-	// task.End()
+	return errors.Join(errs...)
+}
+
+// Schedules the command to be ran on the data source, returning a future
+// that finishes once the command does.
+func (ds *DataSource[T]) Submit(command Command) *Future {
+	return ds.SubmitContext(context.Background(), command)
+}
+
+// Schedules the command to be ran on the data source. If the context is
+// cancelled before the command has started, the command is removed from the
+// schedule and its future finishes with the context's error.
+func (ds *DataSource[T]) SubmitContext(ctx context.Context, command Command) *Future {
+	return ds.submit(ctx, command, 0, nil)
 }
 
-func dataSourceScheduler(data any, wg *sync.WaitGroup, commands <-chan Command, poolSize int) {
-	permissionTable := NewPermissionTable()
+// Schedules the command to be ran on the data source ahead of any pending
+// command of a lower priority. Commands are submitted with a priority of 0
+// unless stated otherwise.
+func (ds *DataSource[T]) SubmitWithPriority(priority int, command Command) *Future {
+	return ds.SubmitWithPriorityContext(context.Background(), priority, command)
+}
 
-	numWorkers := poolSize
-	if numWorkers > 1 {
-		numWorkers -= 1 // Leave one cpu unallocated for the scheduler goroutine
+// Same as SubmitWithPriority, except the command is removed from the schedule
+// if the context is cancelled before the command has started.
+func (ds *DataSource[T]) SubmitWithPriorityContext(ctx context.Context, priority int, command Command) *Future {
+	return ds.submit(ctx, command, priority, nil)
+}
+
+// Same as Run, except every command is submitted with the priority provided.
+func (ds *DataSource[T]) RunWithPriority(priority int, commands ...Command) []*Future {
+	futures := make([]*Future, len(commands))
+	for i, c := range commands {
+		futures[i] = ds.SubmitWithPriority(priority, c)
 	}
-	// numWorkers = 2
+	return futures
+}
 
-	jobs := make(chan *dataSourceWorkerJob, 1000)
-	for i := 0; i < numWorkers; i++ {
-		go dataSourceWorker(i, permissionTable, wg, data, jobs)
+func (ds *DataSource[T]) submit(ctx context.Context, command Command, priority int, after []*Future) *Future {
+	future := newFuture()
+	ds.schedule(&dataSourceWorkerJob{
+		ctx:       ctx,
+		command:   command,
+		index:     ds.nextIndex(),
+		future:    future,
+		scheduled: make(chan struct{}),
+		after:     after,
+		priority:  priority,
+	})
+	return future
+}
+
+// Hands the job to the scheduler, unless the job's context is cancelled
+// while waiting for the scheduler to take it, in which case the job finishes
+// with the context's error.
+func (ds *DataSource[T]) schedule(job *dataSourceWorkerJob) {
+	ds.wg.Add(1)
+	select {
+	case ds.commandsToSchedule <- job:
+	case <-job.ctx.Done():
+		job.finish(ds.wg, ds.errs, job.ctx.Err())
 	}
+}
 
-	for command := range commands {
-		commandData := command.data()
-		commandsPermission := calculatePermissions(data, commandData)
-		for {
-			successful := permissionTable.TryAdd(commandsPermission)
-			if successful {
-				break
-			}
+// Schedules the commands to be ran as a single transaction, one after another
+// in the order provided, with each command seeing the changes made by the
+// commands before it. Changes are only stored in the source once every
+// command has succeeded. If any command fails, none of the changes made by
+// the transaction are kept, and the future finishes with the failing
+// command's error.
+func (ds *DataSource[T]) SubmitTransaction(commands ...Command) *Future {
+	return ds.SubmitTransactionContext(context.Background(), commands...)
+}
 
-			// TODO: Be smarter about waiting until it's valid to try to add again.
-			version := permissionTable.Version()
-			newVersion := version
-			for version == newVersion {
-				newVersion = permissionTable.Version()
-			}
-		}
+// Same as SubmitTransaction, except the transaction is removed from the
+// schedule if the context is cancelled before it has started.
+func (ds *DataSource[T]) SubmitTransactionContext(ctx context.Context, commands ...Command) *Future {
+	future := newFuture()
+	if len(commands) == 0 {
+		future.complete(nil)
+		return future
+	}
 
-		jobs <- &dataSourceWorkerJob{
-			command:     command,
-			permissions: commandsPermission,
-			commandData: commandData,
+	members := make([]*transactionMember, len(commands))
+	for i, command := range commands {
+		members[i] = &transactionMember{
+			command: command,
+			index:   ds.nextIndex(),
 		}
 	}
-	close(jobs)
+
+	ds.schedule(&dataSourceWorkerJob{
+		ctx:         ctx,
+		command:     commands[0],
+		index:       members[0].index,
+		future:      future,
+		scheduled:   make(chan struct{}),
+		transaction: &transaction{members: members},
+	})
+	return future
 }
 
-func (ds *DataSource[T]) RunSequentially(commands ...Command) {
-	for _, c := range commands {
-		commandData := c.data()
-		PopulateView(ds.data, commandData)
-		c.Run()
+// Schedules every command within the graph, returning their futures in the
+// order the commands were added to the graph. Nothing is scheduled if the
+// graph contains a cycle.
+func (ds *DataSource[T]) SubmitGraph(graph *CommandGraph) ([]*Future, error) {
+	return ds.SubmitGraphContext(context.Background(), graph)
+}
+
+// Same as SubmitGraph, except commands that haven't started by the time the
+// context is cancelled are removed from the schedule.
+func (ds *DataSource[T]) SubmitGraphContext(ctx context.Context, graph *CommandGraph) ([]*Future, error) {
+	order, err := graph.topologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	// Commands are submitted after the commands they depend on, so their
+	// dependencies' futures always exist by the time they're needed
+	futures := make([]*Future, len(graph.nodes))
+	for _, node := range order {
+		after := make([]*Future, len(node.after))
+		for i, dependency := range node.after {
+			after[i] = futures[dependency.index]
+		}
+		futures[node.index] = ds.submit(ctx, node.command, 0, after)
 	}
+	return futures, nil
 }
 
-func (ds *DataSource[T]) Run(commands ...Command) {
-	ds.wg.Add(len(commands))
-	for _, c := range commands {
-		ds.commandsToSchedule <- c
+// Schedules all commands to be ran on the data source in the order provided,
+// returning a future for each command.
+func (ds *DataSource[T]) Run(commands ...Command) []*Future {
+	return ds.RunContext(context.Background(), commands...)
+}
+
+// Schedules all commands to be ran on the data source in the order provided,
+// abandoning any command that has not started by the time the context is
+// cancelled.
+func (ds *DataSource[T]) RunContext(ctx context.Context, commands ...Command) []*Future {
+	futures := make([]*Future, len(commands))
+	for i, c := range commands {
+		futures[i] = ds.SubmitContext(ctx, c)
 	}
+	return futures
 }
 
-func (ds *DataSource[T]) Wait() {
+// Blocks until all commands submitted have finished, returning the errors of
+// every command that failed since the last call to Wait. Each error is
+// wrapped in a CommandError.
+func (ds *DataSource[T]) Wait() error {
 	ds.wg.Wait()
+	return ds.errs.flush()
 }
 
-func (ds *DataSource[T]) Close() {
-	ds.Wait()
+func (ds *DataSource[T]) Close() error {
+	err := ds.Wait()
 	close(ds.commandsToSchedule)
+	return err
 }
@@ -1,7 +1,11 @@
 package quill_test
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/EliCDavis/quill"
 	"github.com/stretchr/testify/assert"
@@ -243,3 +247,626 @@ func TestDataSource_ReadWriteCommandOnMap_AppendDataToMap(t *testing.T) {
 	// ASSERT =================================================================
 	assert.Equal(t, 89., sum)
 }
+
+func TestDataSource_WaitReturnsCommandErrors(t *testing.T) {
+	// ARRANGE ================================================================
+	type FloatArrView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	})
+	failure := errors.New("something went wrong")
+
+	// ACT ====================================================================
+	dataSource.Run(
+		&quill.ViewCommand[FloatArrView]{
+			Action: func(view *FloatArrView) error {
+				return nil
+			},
+		},
+		&quill.ViewCommand[FloatArrView]{
+			Action: func(view *FloatArrView) error {
+				return failure
+			},
+		},
+	)
+	err := dataSource.Wait()
+	errAfterFlush := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, err, failure)
+	var commandErr quill.CommandError
+	if assert.ErrorAs(t, err, &commandErr) {
+		assert.Equal(t, 1, commandErr.Index)
+		assert.Equal(t, reflect.TypeOf(FloatArrView{}), commandErr.View)
+	}
+	assert.NoError(t, errAfterFlush)
+}
+
+func TestDataSource_StopOnError(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	dataSource := quill.NewDataSource(
+		NastyData{FloatArr: []float64{1, 2, 3}},
+		quill.WithPoolSize(2),
+		quill.WithStopOnError(),
+	)
+	failure := errors.New("something went wrong")
+	ran := false
+
+	// ACT ====================================================================
+	dataSource.Run(
+		&quill.ViewCommand[WriteFloatArrView]{
+			Action: func(view *WriteFloatArrView) error {
+				return failure
+			},
+		},
+		&quill.ViewCommand[WriteFloatArrView]{
+			Action: func(view *WriteFloatArrView) error {
+				ran = true
+				return nil
+			},
+		},
+	)
+	err := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, err, failure)
+	assert.False(t, ran)
+}
+
+// Every command writes to the same field, holding the permission for a short
+// while, forcing the scheduler to wait on the permission table between each
+// command. Reports the CPU time the process consumed per command alongside
+// the wall time.
+func BenchmarkDataSource_ContendedWrites(b *testing.B) {
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	})
+	action := func(view *WriteFloatArrView) error {
+		time.Sleep(100 * time.Microsecond)
+		return nil
+	}
+
+	b.ResetTimer()
+	start := processCPUTime()
+	for i := 0; i < b.N; i++ {
+		dataSource.Run(&quill.ViewCommand[WriteFloatArrView]{Action: action})
+	}
+	dataSource.Wait()
+	b.ReportMetric(float64(processCPUTime()-start)/float64(b.N), "cpu-ns/op")
+	b.StopTimer()
+
+	dataSource.Close()
+}
+
+func TestDataSource_RecoversPanics(t *testing.T) {
+	// ARRANGE ================================================================
+	type StrView struct {
+		Sub struct {
+			Str *quill.WritePermission[string]
+		}
+	}
+	type ReadStrView struct {
+		Sub struct {
+			Str *quill.ItemReadPermission[string]
+		}
+	}
+
+	data := &NastyData{}
+	data.Sub.Str = "original"
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(1))
+	failure := errors.New("something went wrong")
+	read := ""
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[StrView]{
+			Action: func(view *StrView) error {
+				view.Sub.Str.Write("panicked")
+				panic("oh no")
+			},
+		},
+		&quill.ViewCommand[StrView]{
+			Action: func(view *StrView) error {
+				panic(failure)
+			},
+		},
+		&quill.ViewCommand[ReadStrView]{
+			Action: func(view *ReadStrView) error {
+				read = view.Sub.Str.Value()
+				return nil
+			},
+		},
+	)
+	firstErr := futures[0].Wait()
+	secondErr := futures[1].Wait()
+	thirdErr := futures[2].Wait()
+	err := dataSource.Close()
+
+	// ASSERT =================================================================
+	var panicErr quill.PanicError
+	if assert.ErrorAs(t, firstErr, &panicErr) {
+		assert.Equal(t, "oh no", panicErr.Value)
+		assert.Contains(t, string(panicErr.Stack), "TestDataSource_RecoversPanics")
+	}
+	assert.ErrorIs(t, secondErr, failure)
+	assert.ErrorAs(t, secondErr, &panicErr)
+	assert.NoError(t, thirdErr)
+	assert.Equal(t, "original", read)
+	assert.Equal(t, "original", data.Sub.Str)
+
+	assert.ErrorIs(t, err, failure)
+	assert.ErrorAs(t, err, &panicErr)
+}
+
+func TestDataSource_RunSequentially_RecoversPanics(t *testing.T) {
+	// ARRANGE ================================================================
+	type StrView struct {
+		Sub struct {
+			Str *quill.WritePermission[string]
+		}
+	}
+
+	data := &NastyData{}
+	dataSource := quill.NewDataSource(data)
+	ran := false
+
+	// ACT ====================================================================
+	err := dataSource.RunSequentially(
+		&quill.ViewCommand[StrView]{
+			Action: func(view *StrView) error {
+				view.Sub.Str.Write("panicked")
+				panic("oh no")
+			},
+		},
+		&quill.ViewCommand[StrView]{
+			Action: func(view *StrView) error {
+				ran = true
+				return nil
+			},
+		},
+	)
+
+	// ASSERT =================================================================
+	var panicErr quill.PanicError
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, "oh no", panicErr.Value)
+	}
+	assert.True(t, ran)
+	assert.Equal(t, "", data.Sub.Str)
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestDataSource_PointerSource(t *testing.T) {
+	// ARRANGE ================================================================
+	type Stats struct {
+		Values []float64
+		Total  float64
+	}
+
+	type Source struct {
+		Title   string
+		Stats   *Stats
+		Columns map[string][]float64
+	}
+
+	type SumView struct {
+		Title *quill.WritePermission[string]
+		Stats struct {
+			Values *quill.ArrayReadPermission[float64]
+			Total  *quill.WritePermission[float64]
+		}
+		Columns struct {
+			Doubled []float64
+		}
+	}
+
+	data := Source{
+		Title: "Before",
+		Stats: &Stats{
+			Values: []float64{1, 2, 3},
+		},
+		Columns: map[string][]float64{},
+	}
+	dataSource := quill.NewDataSource(&data)
+
+	// ACT ====================================================================
+	dataSource.Run(&quill.ViewCommand[SumView]{
+		Action: func(view *SumView) error {
+			values := view.Stats.Values.Value()
+			total := 0.
+			doubled := make([]float64, values.Len())
+			for i := 0; i < values.Len(); i++ {
+				total += values.At(i)
+				doubled[i] = values.At(i) * 2
+			}
+			view.Title.Write("After")
+			view.Stats.Total.Write(total)
+			view.Columns.Doubled = doubled
+			return nil
+		},
+	})
+	err := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, "After", data.Title)
+	assert.Equal(t, 6., data.Stats.Total)
+	assert.Equal(t, []float64{2, 4, 6}, data.Columns["Doubled"])
+}
+
+func TestDataSource_PermissionsFollowSourcePointers(t *testing.T) {
+	// ARRANGE ================================================================
+	type Item struct {
+		Count int
+	}
+
+	type Source struct {
+		Values *[]float64
+		Total  *float64
+		Label  *string
+		Items  map[string]*Item
+	}
+
+	type SumView struct {
+		Values *quill.ArrayReadPermission[float64]
+		Total  *quill.WritePermission[float64]
+		Label  *quill.ItemReadPermission[*string]
+		Items  struct {
+			A *quill.ItemWritePermission[Item]
+		}
+	}
+
+	total := 0.
+	label := "Total"
+	values := []float64{1, 2, 3}
+	data := Source{
+		Values: &values,
+		Total:  &total,
+		Label:  &label,
+		Items: map[string]*Item{
+			"A": {Count: 1},
+		},
+	}
+	dataSource := quill.NewDataSource(&data)
+	var labelPointer *string
+
+	// ACT ====================================================================
+	future := dataSource.Submit(&quill.ViewCommand[SumView]{
+		Action: func(view *SumView) error {
+			values := view.Values.Value()
+			sum := 0.
+			for i := 0; i < values.Len(); i++ {
+				sum += values.At(i)
+			}
+			view.Total.Write(sum)
+			view.Items.A.Set(Item{Count: values.Len()})
+			labelPointer = view.Label.Value()
+			return nil
+		},
+	})
+	err := future.Wait()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, 6., total)
+	assert.Same(t, &label, labelPointer)
+	assert.Equal(t, 3, data.Items["A"].Count)
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestPopulateView_PermissionOnNilSourcePointer(t *testing.T) {
+	// ARRANGE ================================================================
+	type Source struct {
+		Values *[]float64
+	}
+
+	type View struct {
+		Values *quill.ArrayReadPermission[float64]
+	}
+
+	// ACT ====================================================================
+	_, err := quill.PopulateView(Source{}, &View{})
+
+	// ASSERT =================================================================
+	var viewErr quill.ViewError
+	if assert.ErrorAs(t, err, &viewErr) {
+		assert.Equal(t, ".Values", viewErr.Path)
+		assert.Equal(t, reflect.Pointer, viewErr.SourceKind)
+	}
+}
+
+func TestPopulateView_NilPointerSource(t *testing.T) {
+	// ARRANGE ================================================================
+	type View struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+	var data *NastyData
+
+	// ACT ====================================================================
+	_, err := quill.PopulateView(data, &View{})
+
+	// ASSERT =================================================================
+	var viewErr quill.ViewError
+	if assert.ErrorAs(t, err, &viewErr) {
+		assert.Equal(t, reflect.Pointer, viewErr.SourceKind)
+	}
+}
+
+func TestDataSource_RejectsInvalidView(t *testing.T) {
+	// ARRANGE ================================================================
+	type InvalidView struct {
+		Sub struct {
+			Missing *quill.ArrayReadPermission[int]
+		}
+	}
+
+	dataSource := quill.NewDataSource(NastyData{})
+	ran := false
+
+	// ACT ====================================================================
+	future := dataSource.Submit(&quill.ViewCommand[InvalidView]{
+		Action: func(view *InvalidView) error {
+			ran = true
+			return nil
+		},
+	})
+	err := future.Wait()
+
+	// ASSERT =================================================================
+	assert.False(t, ran)
+	var viewErr quill.ViewError
+	if assert.ErrorAs(t, err, &viewErr) {
+		assert.Equal(t, ".Sub.Missing", viewErr.Path)
+		assert.Equal(t, reflect.Pointer, viewErr.ViewKind)
+	}
+	assert.ErrorIs(t, dataSource.Close(), err)
+}
+
+// Lots of commands that do next to no work, where the cost of scheduling and
+// populating each command's view dominates.
+func BenchmarkDataSource_SmallCommands(b *testing.B) {
+	type View struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+		Sub      struct {
+			Str *quill.ItemReadPermission[string]
+		}
+		Columns struct {
+			BasePrice *quill.ArrayReadPermission[float64]
+			TaxRate   *quill.ArrayReadPermission[float64]
+		}
+	}
+
+	columns := make(map[string][]float64)
+	for i := 0; i < 100; i++ {
+		columns[fmt.Sprintf("Column%d", i)] = []float64{float64(i)}
+	}
+	columns["BasePrice"] = []float64{10, 20, 50}
+	columns["TaxRate"] = []float64{.2, .15, .08}
+
+	dataSource := quill.NewDataSource(struct {
+		FloatArr []float64
+		Sub      struct {
+			Str string
+		}
+		Columns map[string][]float64
+	}{
+		FloatArr: []float64{1, 2, 3},
+		Columns:  columns,
+	})
+	action := func(view *View) error {
+		return nil
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dataSource.Run(&quill.ViewCommand[View]{Action: action})
+	}
+	dataSource.Wait()
+	b.StopTimer()
+
+	dataSource.Close()
+}
+
+func TestDataSource_TaggedFieldsConflictWithSourceField(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteView struct {
+		FloatArr []float64
+	}
+
+	type TaggedReadView struct {
+		DataToSum *quill.ArrayReadPermission[float64] `quill:"FloatArr"`
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	})
+	release := make(chan struct{})
+	sum := 0.
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[WriteView]{
+			Action: func(view *WriteView) error {
+				<-release
+				for i := range view.FloatArr {
+					view.FloatArr[i] *= 2
+				}
+				return nil
+			},
+		},
+		&quill.ViewCommand[TaggedReadView]{
+			Action: func(view *TaggedReadView) error {
+				floatData := view.DataToSum.Value()
+				for i := 0; i < floatData.Len(); i++ {
+					sum += floatData.At(i)
+				}
+				return nil
+			},
+		},
+	)
+	close(release)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.Equal(t, 12., sum)
+	assert.NoError(t, dataSource.Close())
+}
+
+// Commands reading a couple of columns out of a map containing tens of
+// thousands of columns.
+func BenchmarkDataSource_LargeMap(b *testing.B) {
+	type View struct {
+		Columns struct {
+			BasePrice *quill.ArrayReadPermission[float64]
+			TaxRate   *quill.ArrayReadPermission[float64]
+		}
+	}
+
+	columns := make(map[string][]float64)
+	for i := 0; i < 50_000; i++ {
+		columns[fmt.Sprintf("Column%d", i)] = []float64{float64(i)}
+	}
+	columns["BasePrice"] = []float64{10, 20, 50}
+	columns["TaxRate"] = []float64{.2, .15, .08}
+
+	dataSource := quill.NewDataSource(struct {
+		Columns map[string][]float64
+	}{
+		Columns: columns,
+	})
+	action := func(view *View) error {
+		return nil
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dataSource.Run(&quill.ViewCommand[View]{Action: action})
+	}
+	dataSource.Wait()
+	b.StopTimer()
+
+	dataSource.Close()
+}
+
+func TestDataSource_MapsWithNonStringKeys(t *testing.T) {
+	// ARRANGE ================================================================
+	type ColumnName string
+
+	type View struct {
+		ByIndex struct {
+			Five *quill.ArrayReadPermission[float64] `quill:"5"`
+			Ten  []float64                           `quill:"10"`
+		}
+		ByName struct {
+			Price *quill.ItemReadPermission[float64]
+		}
+	}
+
+	type InvalidView struct {
+		ByIndex struct {
+			Five *quill.ArrayReadPermission[float64]
+		}
+	}
+
+	data := struct {
+		ByIndex map[int][]float64
+		ByName  map[ColumnName]float64
+	}{
+		ByIndex: map[int][]float64{
+			5: {1, 2, 3},
+		},
+		ByName: map[ColumnName]float64{
+			"Price": 12,
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+	five := 0.
+	price := 0.
+
+	// ACT ====================================================================
+	valid := dataSource.Submit(&quill.ViewCommand[View]{
+		Action: func(view *View) error {
+			five = view.ByIndex.Five.Value().At(2)
+			price = view.ByName.Price.Value()
+			view.ByIndex.Ten = []float64{10}
+			return nil
+		},
+	})
+	invalid := dataSource.Submit(&quill.ViewCommand[InvalidView]{
+		Action: func(view *InvalidView) error {
+			return nil
+		},
+	})
+	dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, valid.Err())
+	assert.Equal(t, 3., five)
+	assert.Equal(t, 12., price)
+	assert.Equal(t, []float64{10}, data.ByIndex[10])
+
+	var viewErr quill.ViewError
+	if assert.ErrorAs(t, invalid.Err(), &viewErr) {
+		assert.Equal(t, ".ByIndex.Five", viewErr.Path)
+		assert.Equal(t, reflect.Map, viewErr.SourceKind)
+	}
+}
+
+func TestDataSource_MapKeysSpelledDifferentlyConflict(t *testing.T) {
+	// ARRANGE ================================================================
+	type FiveView struct {
+		ByIndex struct {
+			Five []int `quill:"5"`
+		}
+	}
+
+	type PaddedFiveView struct {
+		ByIndex struct {
+			Five []int `quill:"05"`
+		}
+	}
+
+	data := struct {
+		ByIndex map[int][]int
+	}{
+		ByIndex: map[int][]int{
+			5: {0},
+		},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+	// ACT ====================================================================
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			dataSource.Submit(&quill.ViewCommand[FiveView]{
+				Action: func(view *FiveView) error {
+					view.ByIndex.Five[0]++
+					return nil
+				},
+			})
+			continue
+		}
+		dataSource.Submit(&quill.ViewCommand[PaddedFiveView]{
+			Action: func(view *PaddedFiveView) error {
+				view.ByIndex.Five[0]++
+				return nil
+			},
+		})
+	}
+	err := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, 50, data.ByIndex[5][0])
+}
@@ -0,0 +1,128 @@
+package quill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrCommandSkipped is reported for commands that were never ran because the
+// data source stopped scheduling after a previous command failed.
+var ErrCommandSkipped = errors.New("command skipped due to a previous command failing")
+
+// CommandError annotates an error returned by a command with information
+// about which command produced it.
+type CommandError struct {
+	// Index is the order in which the command was submitted to the data
+	// source, starting at 0.
+	Index int
+
+	// View is the type of the view the command operated on.
+	View reflect.Type
+
+	Err error
+}
+
+func (ce CommandError) Error() string {
+	return fmt.Sprintf("command %d (%s): %s", ce.Index, ce.View, ce.Err.Error())
+}
+
+func (ce CommandError) Unwrap() error {
+	return ce.Err
+}
+
+// PanicError is reported for commands that panicked while running, or whose
+// accumulators' merge functions panicked. Changes the command buffered until
+// it finished are discarded, which covers every write, map, counter,
+// accumulator and append permission. Slices the command wrote to in place,
+// whether through a slice field of the view or an array write permission,
+// already hold whatever the command wrote before it panicked.
+type PanicError struct {
+	// Value the command panicked with
+	Value any
+
+	// Stack trace of the goroutine at the time of the panic
+	Stack []byte
+}
+
+func (pe PanicError) Error() string {
+	return fmt.Sprintf("command panicked: %v", pe.Value)
+}
+
+// Unwraps the value the command panicked with if it was an error
+func (pe PanicError) Unwrap() error {
+	err, _ := pe.Value.(error)
+	return err
+}
+
+// Runs the command, turning any panic into a PanicError
+func runRecovered(ctx context.Context, command Command) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return command.run(ctx)
+}
+
+// Prepares the changes, turning any panic from code supplied by the command
+// into a PanicError
+func prepareRecovered(applyChanges ApplyChanges) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	applyChanges.prepare()
+	return nil
+}
+
+func newCommandError(index int, command Command, err error) CommandError {
+	return CommandError{
+		Index: index,
+		View:  reflect.TypeOf(command.data()).Elem(),
+		Err:   err,
+	}
+}
+
+// Thread safe collection of all errors produced by commands since the last
+// time the collection was flushed
+type commandErrors struct {
+	lock        sync.Mutex
+	errs        []error
+	stopOnError bool
+	halted      bool
+}
+
+func (ce *commandErrors) report(err error) {
+	ce.lock.Lock()
+	defer ce.lock.Unlock()
+	ce.errs = append(ce.errs, err)
+
+	// Cancelling a command isn't a failure of the command itself
+	cancelled := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	if ce.stopOnError && !cancelled {
+		ce.halted = true
+	}
+}
+
+// Whether or not we should refrain from running any more commands
+func (ce *commandErrors) stopped() bool {
+	ce.lock.Lock()
+	defer ce.lock.Unlock()
+	return ce.halted
+}
+
+// Joins all errors reported since the last flush, and resumes scheduling if
+// it had been halted.
+func (ce *commandErrors) flush() error {
+	ce.lock.Lock()
+	defer ce.lock.Unlock()
+	err := errors.Join(ce.errs...)
+	ce.errs = nil
+	ce.halted = false
+	return err
+}
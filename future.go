@@ -0,0 +1,68 @@
+package quill
+
+import "errors"
+
+// Future is a handle to a single command submitted to a data source, which
+// can be used to wait on that command without waiting on everything else
+// scheduled on the data source.
+type Future struct {
+	done chan struct{}
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{
+		done: make(chan struct{}),
+	}
+}
+
+// Must only ever be called once
+func (f *Future) complete(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// Channel that closes once the command has finished, either by running or by
+// being skipped.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Blocks until the command has finished, returning the command's error.
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// The error the command finished with. Returns nil if the command is still
+// running or finished successfully.
+func (f *Future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+// All creates a future that finishes once every future provided has finished,
+// with an error joining all of their errors.
+func All(futures ...*Future) *Future {
+	all := newFuture()
+	go func() {
+		all.complete(WaitAll(futures...))
+	}()
+	return all
+}
+
+// WaitAll blocks until every future provided has finished, returning all of
+// their errors joined together.
+func WaitAll(futures ...*Future) error {
+	errs := make([]error, 0)
+	for _, f := range futures {
+		if err := f.Wait(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package quill_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuture_WaitOnSingleCommand(t *testing.T) {
+	// ARRANGE ================================================================
+	type FloatArrView struct {
+		FloatArr []float64
+	}
+
+	type StrArrView struct {
+		StrArr *quill.ArrayReadPermission[string]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+		StrArr:   []string{"a", "b", "c"},
+	}, quill.WithPoolSize(3))
+	release := make(chan struct{})
+	joined := ""
+
+	// ACT ====================================================================
+	blocked := dataSource.Submit(&quill.ViewCommand[FloatArrView]{
+		Action: func(view *FloatArrView) error {
+			<-release
+			return nil
+		},
+	})
+	readStr := dataSource.Submit(&quill.ViewCommand[StrArrView]{
+		Action: func(view *StrArrView) error {
+			strs := view.StrArr.Value()
+			for i := 0; i < strs.Len(); i++ {
+				joined += strs.At(i)
+			}
+			return nil
+		},
+	})
+	readErr := readStr.Wait()
+	blockedErrBeforeRelease := blocked.Err()
+
+	close(release)
+
+	// ASSERT =================================================================
+	assert.NoError(t, readErr)
+	assert.Equal(t, "abc", joined)
+	assert.NoError(t, blockedErrBeforeRelease)
+	assert.NoError(t, blocked.Wait())
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestFuture_All(t *testing.T) {
+	// ARRANGE ================================================================
+	type FloatArrView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	})
+	failure := errors.New("something went wrong")
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[FloatArrView]{
+			Action: func(view *FloatArrView) error {
+				return nil
+			},
+		},
+		&quill.ViewCommand[FloatArrView]{
+			Action: func(view *FloatArrView) error {
+				return failure
+			},
+		},
+	)
+	all := quill.All(futures...)
+	<-all.Done()
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, all.Err(), failure)
+	assert.NoError(t, futures[0].Err())
+	assert.ErrorIs(t, futures[1].Err(), failure)
+	assert.ErrorIs(t, dataSource.Close(), failure)
+}
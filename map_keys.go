@@ -0,0 +1,177 @@
+package quill
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Permission whose paths are only known once the view has been created, such
+// as the keys of a map supplied by the command before it's submitted
+type dynamicPermission interface {
+	presetPermission
+
+	// Keys of the map entries the permission requires access to
+	entries() []reflect.Value
+}
+
+// MapKeys grants a command access to a set of keys of a map within the
+// source, where the keys are decided at runtime rather than by the view's
+// struct fields. The keys must be declared before the command is submitted,
+// by setting the view's field through the command's View method:
+//
+//	command := &quill.ViewCommand[ColumnsView]{Action: ...}
+//	command.View().Columns = quill.NewMapKeys[string, []float64](quill.ReadPermissionType, columns...)
+//
+// Each key is locked individually, so commands accessing different keys of
+// the same map are free to run in parallel. Changes made through Set and
+// Delete are stored in the source's map once the command has finished.
+type MapKeys[K comparable, V any] struct {
+	keys     []K
+	declared map[K]struct{}
+	perm     PermissionType
+
+	values  map[K]V
+	changes map[K]*V // nil entries are deletions
+	target  reflect.Value
+}
+
+// Declares the keys of a map a command requires, along with whether the
+// command reads or writes them.
+func NewMapKeys[K comparable, V any](perm PermissionType, keys ...K) *MapKeys[K, V] {
+	declared := make(map[K]struct{}, len(keys))
+	unique := make([]K, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := declared[key]; ok {
+			continue
+		}
+		declared[key] = struct{}{}
+		unique = append(unique, key)
+	}
+
+	return &MapKeys[K, V]{
+		keys:     unique,
+		declared: declared,
+		perm:     perm,
+	}
+}
+
+// Keys declared, in the order they were declared
+func (mk MapKeys[K, V]) Keys() []K {
+	return mk.keys
+}
+
+func (mk MapKeys[K, V]) mustBeDeclared(key K) {
+	if _, ok := mk.declared[key]; !ok {
+		panic(fmt.Errorf("map key '%v' was never declared", key))
+	}
+}
+
+// Value of the entry, including any changes made by the command. Panics if
+// the key was never declared.
+func (mk MapKeys[K, V]) Get(key K) (V, bool) {
+	mk.mustBeDeclared(key)
+	if change, ok := mk.changes[key]; ok {
+		if change == nil {
+			var zero V
+			return zero, false
+		}
+		return *change, true
+	}
+	v, ok := mk.values[key]
+	return v, ok
+}
+
+func (mk *MapKeys[K, V]) mustBeWritable(key K) {
+	mk.mustBeDeclared(key)
+	if mk.perm != WritePermissionType {
+		panic(fmt.Errorf("map key '%v' was declared read only", key))
+	}
+	if mk.changes == nil {
+		mk.changes = make(map[K]*V)
+	}
+}
+
+// Sets the entry of the map. Panics if the key was never declared, or was
+// declared read only.
+func (mk *MapKeys[K, V]) Set(key K, value V) {
+	mk.mustBeWritable(key)
+	mk.changes[key] = &value
+}
+
+// Deletes the entry of the map. Panics if the key was never declared, or was
+// declared read only.
+func (mk *MapKeys[K, V]) Delete(key K) {
+	mk.mustBeWritable(key)
+	mk.changes[key] = nil
+}
+
+func (mk *MapKeys[K, V]) validate() error {
+	if mk.perm != ReadPermissionType && mk.perm != WritePermissionType {
+		return fmt.Errorf("map keys can only be declared with read or write permission, not permission type %d", mk.perm)
+	}
+	return nil
+}
+
+func (mk *MapKeys[K, V]) entries() []reflect.Value {
+	declared := reflect.ValueOf(mk.keys)
+	keys := make([]reflect.Value, len(mk.keys))
+	for i := range keys {
+		keys[i] = declared.Index(i)
+	}
+	return keys
+}
+
+func (mk *MapKeys[K, V]) inject(val reflect.Value) error {
+	if mk.perm == WritePermissionType && !val.CanSet() {
+		return fmt.Errorf("can not populate writable map keys with a value that can not be assigned to")
+	}
+	data, err := mapFromValue[K, V](val)
+	if err != nil {
+		return err
+	}
+
+	mk.values = make(map[K]V, len(mk.keys))
+	for _, key := range mk.keys {
+		if v, ok := data[key]; ok {
+			mk.values[key] = v
+		}
+	}
+	mk.changes = nil
+	mk.target = val
+	return nil
+}
+
+// Clears the data populated, keeping the keys declared
+func (mk *MapKeys[K, V]) clear() {
+	mk.values = nil
+	mk.changes = nil
+	mk.target = reflect.Value{}
+}
+
+func (mk *MapKeys[K, V]) written() bool {
+	return len(mk.changes) > 0
+}
+
+func (mk *MapKeys[K, V]) apply() {
+	if len(mk.changes) == 0 {
+		return
+	}
+
+	// Look at the target again rather than the map we were populated with,
+	// as some other command may have since created the map
+	if mk.target.IsNil() {
+		mk.target.Set(reflect.MakeMap(mk.target.Type()))
+	}
+	data := mk.target.Interface().(map[K]V)
+	for key, change := range mk.changes {
+		if change == nil {
+			delete(data, key)
+			continue
+		}
+		data[key] = *change
+	}
+}
+
+func (mk MapKeys[K, V]) Type() PermissionType {
+	return mk.perm
+}
@@ -0,0 +1,272 @@
+package quill_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+type CSVData struct {
+	Title   string
+	Columns map[string][]float64
+}
+
+type ColumnsView struct {
+	Columns *quill.MapKeys[string, []float64]
+}
+
+func TestMapKeys_DisjointKeysRunInParallel(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &CSVData{
+		Columns: map[string][]float64{
+			"BasePrice": {10, 20},
+			"TaxRate":   {.5, .25},
+		},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+	// Each command waits on the other to start, which only ever happens if
+	// both are running at the same time
+	started := sync.WaitGroup{}
+	started.Add(2)
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+
+	newCommand := func(read, write string) *quill.ViewCommand[ColumnsView] {
+		command := &quill.ViewCommand[ColumnsView]{
+			Action: func(view *ColumnsView) error {
+				started.Done()
+				select {
+				case <-allStarted:
+				case <-time.After(time.Second):
+					return assert.AnError
+				}
+
+				column, _ := view.Columns.Get(read)
+				doubled := make([]float64, len(column))
+				for i, v := range column {
+					doubled[i] = v * 2
+				}
+				view.Columns.Set(write, doubled)
+				return nil
+			},
+		}
+		command.View().Columns = quill.NewMapKeys[string, []float64](quill.WritePermissionType, read, write)
+		return command
+	}
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		newCommand("BasePrice", "DoubledPrice"),
+		newCommand("TaxRate", "DoubledRate"),
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []float64{20, 40}, data.Columns["DoubledPrice"])
+	assert.Equal(t, []float64{1, .5}, data.Columns["DoubledRate"])
+}
+
+func TestMapKeys_ConflictsWithStaticKeys(t *testing.T) {
+	// ARRANGE ================================================================
+	type ReadPriceView struct {
+		Columns struct {
+			Price *quill.ArrayReadPermission[float64]
+		}
+	}
+
+	dataSource := quill.NewDataSource(CSVData{}, quill.WithPoolSize(4))
+	release := make(chan struct{})
+	read := 0.
+
+	write := &quill.ViewCommand[ColumnsView]{
+		Action: func(view *ColumnsView) error {
+			<-release
+			view.Columns.Set("Price", []float64{5})
+			return nil
+		},
+	}
+	write.View().Columns = quill.NewMapKeys[string, []float64](quill.WritePermissionType, "Price")
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		write,
+		&quill.ViewCommand[ReadPriceView]{
+			Action: func(view *ReadPriceView) error {
+				read = view.Columns.Price.Value().At(0)
+				return nil
+			},
+		},
+	)
+	close(release)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, 5., read)
+}
+
+func TestMapKeys_KeysThatLookLikePaths(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &CSVData{
+		Columns: map[string][]float64{
+			"price":     {1},
+			"price.usd": {2},
+			"[0:5]":     {3},
+			"[3:8]":     {4},
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+
+	command := &quill.ViewCommand[ColumnsView]{
+		Action: func(view *ColumnsView) error {
+			for _, key := range view.Columns.Keys() {
+				column, _ := view.Columns.Get(key)
+				view.Columns.Set(key, []float64{column[0] * 10})
+			}
+			return nil
+		},
+	}
+	command.View().Columns = quill.NewMapKeys[string, []float64](quill.WritePermissionType, "price", "price.usd", "[0:5]", "[3:8]")
+
+	// ACT ====================================================================
+	err := dataSource.Submit(command).Wait()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err, "keys should not be mistaken for nested paths or ranges")
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, map[string][]float64{
+		"price":     {10},
+		"price.usd": {20},
+		"[0:5]":     {30},
+		"[3:8]":     {40},
+	}, data.Columns)
+}
+
+func TestMapKeys_DeleteKey(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &CSVData{
+		Columns: map[string][]float64{
+			"BasePrice": {10, 20},
+			"TaxRate":   {.5, .25},
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+	command := &quill.ViewCommand[ColumnsView]{
+		Action: func(view *ColumnsView) error {
+			view.Columns.Delete("TaxRate")
+			return nil
+		},
+	}
+	command.View().Columns = quill.NewMapKeys[string, []float64](quill.WritePermissionType, "TaxRate")
+
+	// ACT ====================================================================
+	err := dataSource.Submit(command).Wait()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, map[string][]float64{"BasePrice": {10, 20}}, data.Columns)
+}
+
+func TestMapKeys_ReadOnlyKeysPanicOnSet(t *testing.T) {
+	// ARRANGE ================================================================
+	keys := quill.NewMapKeys[string, []float64](quill.ReadPermissionType, "BasePrice")
+
+	// ACT / ASSERT ===========================================================
+	assert.Panics(t, func() {
+		keys.Set("BasePrice", nil)
+	})
+	assert.Panics(t, func() {
+		keys.Get("Undeclared")
+	})
+}
+
+func TestMapKeys_InvalidViews(t *testing.T) {
+	type OverlappingView struct {
+		Columns struct {
+			Price *quill.ArrayReadPermission[float64]
+		}
+		Keys *quill.MapKeys[string, []float64] `quill:"Columns"`
+	}
+
+	t.Run("keys never declared", func(t *testing.T) {
+		// ARRANGE ============================================================
+		dataSource := quill.NewDataSource(CSVData{})
+
+		// ACT ================================================================
+		err := dataSource.Submit(&quill.ViewCommand[ColumnsView]{
+			Action: func(view *ColumnsView) error {
+				return nil
+			},
+		}).Wait()
+
+		// ASSERT =============================================================
+		var viewErr quill.ViewError
+		if assert.ErrorAs(t, err, &viewErr) {
+			assert.Equal(t, ".Columns", viewErr.Path)
+		}
+		dataSource.Close()
+	})
+
+	t.Run("keys also accessed by another field", func(t *testing.T) {
+		// ARRANGE ============================================================
+		dataSource := quill.NewDataSource(CSVData{})
+		command := &quill.ViewCommand[OverlappingView]{
+			Action: func(view *OverlappingView) error {
+				return nil
+			},
+		}
+		command.View().Keys = quill.NewMapKeys[string, []float64](quill.WritePermissionType, "Price")
+
+		// ACT ================================================================
+		err := dataSource.Submit(command).Wait()
+
+		// ASSERT =============================================================
+		var viewErr quill.ViewError
+		if assert.ErrorAs(t, err, &viewErr) {
+			assert.Equal(t, ".Keys", viewErr.Path)
+		}
+		dataSource.Close()
+	})
+
+	for name, perm := range map[string]quill.PermissionType{
+		"keys declared for appending":    quill.AppendPermissionType,
+		"keys declared for accumulating": quill.AccumulatePermissionType,
+	} {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			data := &CSVData{
+				Columns: map[string][]float64{"Price": {1}},
+			}
+			dataSource := quill.NewDataSource(data)
+			ran := false
+			command := &quill.ViewCommand[ColumnsView]{
+				Action: func(view *ColumnsView) error {
+					ran = true
+					return nil
+				},
+			}
+			command.View().Columns = quill.NewMapKeys[string, []float64](perm, "Price")
+
+			// ACT ============================================================
+			err := dataSource.Submit(command).Wait()
+
+			// ASSERT =========================================================
+			var viewErr quill.ViewError
+			if assert.ErrorAs(t, err, &viewErr) {
+				assert.Equal(t, ".Columns", viewErr.Path)
+				assert.Contains(t, viewErr.Reason, "read or write")
+			}
+			assert.False(t, ran)
+			dataSource.Close()
+		})
+	}
+}
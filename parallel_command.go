@@ -0,0 +1,239 @@
+package quill
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Command that can be split into commands operating on disjoint chunks of a
+// slice within the source, allowing the chunks to run in parallel.
+type chunkedCommand interface {
+	Command
+
+	// Number of elements within the slice. Only valid once the command's view
+	// has been populated.
+	length() int
+
+	// Commands operating on the elements within each range of the slice
+	split(ranges []sliceRange) []Command
+}
+
+// Builds a view that reaches a field of the provided type through a chain of
+// nested structs, one per segment of the path, so commands addressing data by
+// path can be scheduled like any other.
+func pathViewType(path string, leaf reflect.Type) reflect.Type {
+	segments := strings.Split(path, ".")
+	viewType := leaf
+	for i := len(segments) - 1; i >= 0; i-- {
+		viewType = reflect.StructOf([]reflect.StructField{{
+			Name: "Data",
+			Type: viewType,
+			Tag:  reflect.StructTag("quill:" + strconv.Quote(segments[i])),
+		}})
+	}
+	return viewType
+}
+
+// Field at the end of the chain of nested structs built by pathViewType
+func pathViewLeaf(view reflect.Value) reflect.Value {
+	view = view.Elem()
+	for view.Kind() == reflect.Struct {
+		view = view.Field(0)
+	}
+	return view
+}
+
+// ParallelArrayCommand applies an action to every element of a slice within
+// the source, splitting the slice into chunks sized to the data source's pool
+// and running each chunk in parallel. Each chunk holds write access to its
+// range of the slice alone, and the command as a whole finishes once every
+// chunk has.
+type ParallelArrayCommand[T any] struct {
+	// Path to the slice within the source, such as "FloatArr" or
+	// "Sub.IntArr". Map entries are addressed by key.
+	Path string
+
+	// Ran once per chunk with the elements of the chunk, along with the index
+	// within the slice the chunk starts at.
+	Action func(start int, chunk []T) error
+
+	viewOnce sync.Once
+	view     reflect.Value
+}
+
+func (pac *ParallelArrayCommand[T]) data() any {
+	pac.viewOnce.Do(func() {
+		pac.view = reflect.New(pathViewType(pac.Path, reflect.TypeOf([]T(nil))))
+	})
+	return pac.view.Interface()
+}
+
+// Slice the command's view was populated with
+func (pac *ParallelArrayCommand[T]) slice() []T {
+	return pathViewLeaf(pac.view).Interface().([]T)
+}
+
+func (pac *ParallelArrayCommand[T]) length() int {
+	return len(pac.slice())
+}
+
+// Runs the action over the entire slice as a single chunk
+func (pac *ParallelArrayCommand[T]) Run() error {
+	return pac.Action(0, pac.slice())
+}
+
+func (pac *ParallelArrayCommand[T]) run(ctx context.Context) error {
+	return pac.Run()
+}
+
+func (pac *ParallelArrayCommand[T]) split(ranges []sliceRange) []Command {
+	chunks := make([]Command, len(ranges))
+	for i, r := range ranges {
+		chunks[i] = &parallelArrayChunk[T]{
+			parent: pac,
+			start:  r.start,
+			end:    r.end,
+		}
+	}
+	return chunks
+}
+
+type parallelArrayChunk[T any] struct {
+	parent     *ParallelArrayCommand[T]
+	start, end int
+}
+
+func (pac *parallelArrayChunk[T]) Run() error {
+	return pac.parent.Action(pac.start, pac.parent.slice()[pac.start:pac.end:pac.end])
+}
+
+func (pac *parallelArrayChunk[T]) run(ctx context.Context) error {
+	return pac.Run()
+}
+
+func (pac *parallelArrayChunk[T]) data() any {
+	return pac.parent.data()
+}
+
+// MapReduceCommand reads a slice within the source in parallel, splitting the
+// slice into chunks sized to the data source's pool. Map is ran once per chunk
+// to produce a partial result, and the partial results are combined in the
+// order of the chunks they came from with Reduce. Each chunk only holds read
+// access to its range of the slice.
+//
+// The combined result is available through the ResultFuture returned by
+// SubmitMapReduce.
+type MapReduceCommand[T, R any] struct {
+	// Path to the slice within the source, such as "FloatArr" or
+	// "Sub.IntArr". Map entries are addressed by key.
+	Path string
+
+	// Ran once per chunk with the elements of the chunk, along with the index
+	// within the slice the chunk starts at.
+	Map func(start int, chunk []T) (R, error)
+
+	// Combines two partial results, where a came from the elements before b.
+	Reduce func(a, b R) R
+
+	viewOnce sync.Once
+	view     reflect.Value
+
+	partialsLock sync.Mutex
+	partials     []mapReducePartial[R]
+}
+
+type mapReducePartial[R any] struct {
+	start int
+	value R
+}
+
+func (mrc *MapReduceCommand[T, R]) data() any {
+	mrc.viewOnce.Do(func() {
+		mrc.view = reflect.New(pathViewType(mrc.Path, reflect.TypeOf(&ArraySliceReadPermission[T]{})))
+	})
+	return mrc.view.Interface()
+}
+
+// Slice the command's view was populated with
+func (mrc *MapReduceCommand[T, R]) slice() []T {
+	return pathViewLeaf(mrc.view).Interface().(*ArraySliceReadPermission[T]).data
+}
+
+func (mrc *MapReduceCommand[T, R]) length() int {
+	return len(mrc.slice())
+}
+
+// Maps the entire slice as a single chunk
+func (mrc *MapReduceCommand[T, R]) Run() error {
+	mrc.partials = nil
+	return mrc.mapChunk(0, mrc.slice())
+}
+
+func (mrc *MapReduceCommand[T, R]) run(ctx context.Context) error {
+	return mrc.Run()
+}
+
+func (mrc *MapReduceCommand[T, R]) mapChunk(start int, chunk []T) error {
+	value, err := mrc.Map(start, chunk)
+	if err != nil {
+		return err
+	}
+
+	mrc.partialsLock.Lock()
+	defer mrc.partialsLock.Unlock()
+	mrc.partials = append(mrc.partials, mapReducePartial[R]{start: start, value: value})
+	return nil
+}
+
+func (mrc *MapReduceCommand[T, R]) split(ranges []sliceRange) []Command {
+	mrc.partials = nil
+	chunks := make([]Command, len(ranges))
+	for i, r := range ranges {
+		chunks[i] = &mapReduceChunk[T, R]{
+			parent: mrc,
+			start:  r.start,
+			end:    r.end,
+		}
+	}
+	return chunks
+}
+
+// Reduces the partial results of every chunk in order
+func (mrc *MapReduceCommand[T, R]) result() R {
+	mrc.partialsLock.Lock()
+	defer mrc.partialsLock.Unlock()
+
+	var result R
+	sort.Slice(mrc.partials, func(i, j int) bool {
+		return mrc.partials[i].start < mrc.partials[j].start
+	})
+	for i, partial := range mrc.partials {
+		if i == 0 {
+			result = partial.value
+			continue
+		}
+		result = mrc.Reduce(result, partial.value)
+	}
+	return result
+}
+
+type mapReduceChunk[T, R any] struct {
+	parent     *MapReduceCommand[T, R]
+	start, end int
+}
+
+func (mrc *mapReduceChunk[T, R]) Run() error {
+	return mrc.parent.mapChunk(mrc.start, mrc.parent.slice()[mrc.start:mrc.end:mrc.end])
+}
+
+func (mrc *mapReduceChunk[T, R]) run(ctx context.Context) error {
+	return mrc.Run()
+}
+
+func (mrc *mapReduceChunk[T, R]) data() any {
+	return mrc.parent.data()
+}
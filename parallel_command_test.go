@@ -0,0 +1,299 @@
+package quill_test
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelArrayCommand_AppliesToEveryElement(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &NastyData{
+		FloatArr: make([]float64, 100),
+	}
+	for i := range data.FloatArr {
+		data.FloatArr[i] = float64(i)
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	startsLock := sync.Mutex{}
+	starts := make([]int, 0)
+
+	// ACT ====================================================================
+	err := dataSource.Submit(&quill.ParallelArrayCommand[float64]{
+		Path: "FloatArr",
+		Action: func(start int, chunk []float64) error {
+			startsLock.Lock()
+			starts = append(starts, start)
+			startsLock.Unlock()
+
+			for i := range chunk {
+				chunk[i] *= 2
+			}
+			return nil
+		},
+	}).Wait()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	sort.Ints(starts)
+	assert.Equal(t, []int{0, 33, 66}, starts)
+	for i, v := range data.FloatArr {
+		assert.Equal(t, float64(i*2), v)
+	}
+}
+
+func TestParallelArrayCommand_ChunksRunInParallel(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &NastyData{
+		Sub: struct {
+			IntArr []int
+			Str    string
+		}{
+			IntArr: []int{1, 2, 3, 4},
+		},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(3))
+
+	// Every chunk waits on every other chunk to start, which only ever
+	// happens if they're all running at the same time
+	started := sync.WaitGroup{}
+	started.Add(2)
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+
+	// ACT ====================================================================
+	err := dataSource.Submit(&quill.ParallelArrayCommand[int]{
+		Path: "Sub.IntArr",
+		Action: func(start int, chunk []int) error {
+			started.Done()
+			select {
+			case <-allStarted:
+			case <-time.After(time.Second):
+				return assert.AnError
+			}
+
+			for i := range chunk {
+				chunk[i] += start
+			}
+			return nil
+		},
+	}).Wait()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []int{1, 2, 5, 6}, data.Sub.IntArr)
+}
+
+func TestParallelArrayCommand_SamplesLengthOnceAdmitted(t *testing.T) {
+	// ARRANGE ================================================================
+	type ResizeView struct {
+		FloatArr *quill.WritePermission[[]float64]
+	}
+
+	type ReadView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1},
+	}, quill.WithPoolSize(4))
+	release := make(chan struct{})
+	read := make([]float64, 0)
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[ResizeView]{
+			Action: func(view *ResizeView) error {
+				<-release
+				view.FloatArr.Write([]float64{1, 2, 3, 4, 5, 6})
+				return nil
+			},
+		},
+		&quill.ParallelArrayCommand[float64]{
+			Path: "FloatArr",
+			Action: func(start int, chunk []float64) error {
+				for i := range chunk {
+					chunk[i] = -chunk[i]
+				}
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadView]{
+			Action: func(view *ReadView) error {
+				values := view.FloatArr.Value()
+				for i := 0; i < values.Len(); i++ {
+					read = append(read, values.At(i))
+				}
+				return nil
+			},
+		},
+	)
+	close(release)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []float64{-1, -2, -3, -4, -5, -6}, read)
+}
+
+func TestParallelArrayCommand_ChunkErrorsFinishSingleFuture(t *testing.T) {
+	// ARRANGE ================================================================
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3, 4, 5, 6},
+	}, quill.WithPoolSize(4))
+	errBadChunk := errors.New("bad chunk")
+
+	// ACT ====================================================================
+	future := dataSource.Submit(&quill.ParallelArrayCommand[float64]{
+		Path: "FloatArr",
+		Action: func(start int, chunk []float64) error {
+			if start == 0 {
+				return errBadChunk
+			}
+			return nil
+		},
+	})
+	err := future.Wait()
+
+	// ASSERT =================================================================
+	var commandErr quill.CommandError
+	if assert.ErrorAs(t, err, &commandErr) {
+		assert.Equal(t, 0, commandErr.Index)
+	}
+	assert.ErrorIs(t, err, errBadChunk)
+	assert.ErrorIs(t, dataSource.Close(), errBadChunk)
+}
+
+func TestParallelArrayCommand_RunSequentially(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &NastyData{
+		FloatArr: []float64{1, 2, 3},
+	}
+	dataSource := quill.NewDataSource(data)
+	starts := make([]int, 0)
+
+	// ACT ====================================================================
+	err := dataSource.RunSequentially(&quill.ParallelArrayCommand[float64]{
+		Path: "FloatArr",
+		Action: func(start int, chunk []float64) error {
+			starts = append(starts, start)
+			for i := range chunk {
+				chunk[i] += 1
+			}
+			return nil
+		},
+	})
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []int{0}, starts)
+	assert.Equal(t, []float64{2, 3, 4}, data.FloatArr)
+}
+
+func TestMapReduceCommand_CombinesChunksInOrder(t *testing.T) {
+	// ARRANGE ================================================================
+	data := NastyData{
+		StrArr: []string{"a", "b", "c", "d", "e", "f", "g"},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+	// ACT ====================================================================
+	result, err := quill.SubmitMapReduce(dataSource, &quill.MapReduceCommand[string, string]{
+		Path: "StrArr",
+		Map: func(start int, chunk []string) (string, error) {
+			joined := ""
+			for _, s := range chunk {
+				joined += s
+			}
+			return joined, nil
+		},
+		Reduce: func(a, b string) string {
+			return a + b
+		},
+	}).Result()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdefg", result)
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestMapReduceCommand_ChunksShareReadAccess(t *testing.T) {
+	// ARRANGE ================================================================
+	type ReadView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3, 4, 5, 6},
+	}, quill.WithPoolSize(4))
+	release := make(chan struct{})
+
+	// ACT ====================================================================
+	blocking := dataSource.Submit(&quill.ViewCommand[ReadView]{
+		Action: func(view *ReadView) error {
+			<-release
+			return nil
+		},
+	})
+	sum, err := quill.SubmitMapReduce(dataSource, &quill.MapReduceCommand[float64, float64]{
+		Path: "FloatArr",
+		Map: func(start int, chunk []float64) (float64, error) {
+			total := 0.
+			for _, v := range chunk {
+				total += v
+			}
+			return total, nil
+		},
+		Reduce: func(a, b float64) float64 {
+			return a + b
+		},
+	}).Result()
+	close(release)
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, 21., sum)
+	assert.NoError(t, blocking.Wait())
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestParallelArrayCommand_ChunkPanics(t *testing.T) {
+	// ARRANGE ================================================================
+	data := &NastyData{FloatArr: make([]float64, 100)}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+	// ACT ====================================================================
+	err := dataSource.Submit(&quill.ParallelArrayCommand[float64]{
+		Path: "FloatArr",
+		Action: func(start int, chunk []float64) error {
+			if start == 0 {
+				panic("oh no")
+			}
+			return nil
+		},
+	}).Wait()
+	afterErr := dataSource.Submit(&quill.ParallelArrayCommand[float64]{
+		Path: "FloatArr",
+		Action: func(start int, chunk []float64) error {
+			return nil
+		},
+	}).Wait()
+	dataSource.Close()
+
+	// ASSERT =================================================================
+	var panicErr quill.PanicError
+	assert.ErrorAs(t, err, &panicErr)
+	assert.NoError(t, afterErr)
+}
@@ -1,16 +1,95 @@
 package quill
 
-import "reflect"
+import (
+	"fmt"
+	"reflect"
+)
 
 type Permission interface {
-	inject(reflect.Value)
+	inject(reflect.Value) error
 	clear()
 	Type() PermissionType
 }
 
+// Permission that can be restricted to a range of a slice within the source
+type rangePermission interface {
+	Permission
+
+	// Populates the permission with the portion of the slice within range,
+	// starting at the index provided
+	injectRange(val reflect.Value, start int) error
+}
+
 type PermissionType int
 
 const (
 	ReadPermissionType PermissionType = iota
 	WritePermissionType
+
+	// Grants the ability to add elements to the end of a slice. Appenders can
+	// share a slice with one another, but not with readers or writers.
+	AppendPermissionType
+
+	// Grants the ability to merge deltas into a field without reading it.
+	// Accumulators can share a field with one another, but not with readers,
+	// writers or appenders.
+	AccumulatePermissionType
+
+	permissionTypeCount
 )
+
+// Interprets the value as a slice of T for array permissions to hold onto
+func sliceFromValue[T any](val reflect.Value) ([]T, error) {
+	t := val.Kind()
+	if t != reflect.Slice {
+		return nil, fmt.Errorf("can not populate an array permission with value of type: %s", t.String())
+	}
+
+	if !val.CanInterface() {
+		return nil, fmt.Errorf("can not populate an array permission with an unexported field")
+	}
+
+	data, ok := val.Interface().([]T)
+	if !ok {
+		var expected []T
+		return nil, fmt.Errorf("can not populate an array permission of %T with value of type: %s", expected, val.Type())
+	}
+	return data, nil
+}
+
+// Interprets the value as T for item permissions to hold onto
+func itemFromValue[T any](val reflect.Value) (T, error) {
+	var data T
+	if !val.IsValid() {
+		return data, fmt.Errorf("can not populate an item permission with a value that does not exist")
+	}
+
+	if !val.CanInterface() {
+		return data, fmt.Errorf("can not populate an item permission with an unexported field")
+	}
+
+	data, ok := val.Interface().(T)
+	if !ok {
+		return data, fmt.Errorf("can not populate an item permission of %s with value of type: %s", reflect.TypeOf(&data).Elem(), val.Type())
+	}
+	return data, nil
+}
+
+// Interprets the value as a map of K to V for map permissions to hold onto
+func mapFromValue[K comparable, V any](val reflect.Value) (map[K]V, error) {
+	t := val.Kind()
+	if t != reflect.Map {
+		return nil, fmt.Errorf("can not populate a map permission with value of type: %s", t.String())
+	}
+
+	if !val.CanInterface() {
+		return nil, fmt.Errorf("can not populate a map permission with an unexported field")
+	}
+
+	data, ok := val.Interface().(map[K]V)
+	if !ok {
+		var expected map[K]V
+		return nil, fmt.Errorf("can not populate a map permission of %T with value of type: %s", expected, val.Type())
+	}
+	return data, nil
+}
@@ -1,43 +1,86 @@
 package quill
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"sync"
 )
 
+// Permissions held on a single path, along with intent counts summarizing
+// the permissions held on every path nested within it. The intent counts let
+// us detect a conflict between a path and its descendants without having to
+// walk them.
 type permissionLayer struct {
-	// negative values means writing, 0 means unoccupied, positive values is
-	// the number of commands reading.
-	permissions map[string]int
-	children    map[string]*permissionLayer
+	// Number of commands holding each type of permission on this path
+	held [permissionTypeCount]int
+
+	// Number of permissions of each type held on paths nested within this
+	// layer
+	nested [permissionTypeCount]int
+
+	children map[string]*permissionLayer
 }
 
 func newPermissionLayer() permissionLayer {
 	return permissionLayer{
-		permissions: make(map[string]int),
-		children:    make(map[string]*permissionLayer),
+		children: make(map[string]*permissionLayer),
 	}
 }
 
+func (pl *permissionLayer) empty() bool {
+	return pl.held == [permissionTypeCount]int{} && pl.nested == [permissionTypeCount]int{}
+}
+
 func (pl *permissionLayer) Conflict(keys []string, newPerm PermissionType) bool {
 	if len(keys) == 0 {
 		panic("conflict should never be passed 0 keys")
 	}
 
-	rootKey := keys[0]
-	if curPerm, ok := pl.permissions[rootKey]; ok {
-		if newPerm == WritePermissionType || curPerm < 0 {
-			return true
+	// Ranges of a slice conflict with every overlapping range of the same
+	// slice, not just the identical range
+	if len(keys) == 1 {
+		if r, ok := rangeFromSegment(keys[0]); ok {
+			for key, layer := range pl.children {
+				other, ok := rangeFromSegment(key)
+				if ok && r.overlaps(other) && layer.conflictsWithin(newPerm) {
+					return true
+				}
+			}
+			return false
 		}
 	}
 
+	layer, ok := pl.children[keys[0]]
+	if !ok {
+		return false
+	}
+
+	// Ancestor of the path being requested
 	if len(keys) > 1 {
-		if curPerm, ok := pl.children[rootKey]; ok {
-			return curPerm.Conflict(keys[1:], newPerm)
+		if countsConflict(layer.held, newPerm) {
+			return true
 		}
+		return layer.Conflict(keys[1:], newPerm)
 	}
 
+	return layer.conflictsWithin(newPerm)
+}
+
+// Whether or not the permission conflicts with the permissions held on this
+// layer's path, or anything nested within it
+func (pl *permissionLayer) conflictsWithin(newPerm PermissionType) bool {
+	return countsConflict(pl.held, newPerm) || countsConflict(pl.nested, newPerm)
+}
+
+func countsConflict(counts [permissionTypeCount]int, newPerm PermissionType) bool {
+	for perm, count := range counts {
+		if count > 0 && !permissionsCompatible(PermissionType(perm), newPerm) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -47,71 +90,354 @@ func (pl *permissionLayer) Add(keys []string, newPerm PermissionType) {
 	}
 
 	rootKey := keys[0]
+	layer, ok := pl.children[rootKey]
+	if !ok {
+		newLayer := newPermissionLayer()
+		layer = &newLayer
+		pl.children[rootKey] = layer
+	}
 
 	if len(keys) == 1 {
-		switch newPerm {
+		layer.held[newPerm]++
+		return
+	}
 
-		case WritePermissionType:
-			pl.permissions[rootKey] = -1
+	layer.nested[newPerm]++
+	layer.Add(keys[1:], newPerm)
+}
 
-		case ReadPermissionType:
-			if oldVal, ok := pl.permissions[rootKey]; ok {
-				pl.permissions[rootKey] = oldVal + 1
-			} else {
-				pl.permissions[rootKey] = 1
-			}
+func (pl *permissionLayer) Clear(keys []string, perm PermissionType) {
+	if len(keys) == 0 {
+		panic("clear should never be passed 0 keys")
+	}
+
+	rootKey := keys[0]
+	layer, ok := pl.children[rootKey]
+	if !ok {
+		panic(fmt.Errorf("trying to clear permission %s that's never been set", keys))
+	}
+
+	if len(keys) == 1 {
+		if layer.held[perm] == 0 {
+			panic(fmt.Errorf("trying to clear permission %s that's already clear", rootKey))
 		}
+		layer.held[perm]--
+	} else {
+		if layer.nested[perm] == 0 {
+			panic(fmt.Errorf("trying to clear permission %s that's never been set", keys))
+		}
+		layer.nested[perm]--
+		layer.Clear(keys[1:], perm)
+	}
 
-		return
+	// Nothing is held at or beneath this layer anymore, so stop tracking it
+	if layer.empty() {
+		delete(pl.children, rootKey)
+	}
+}
+
+// Whether or not the two paths refer to the same data, or one path is nested
+// within the other.
+func pathsOverlap(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if strings.HasPrefix(b, a) && (len(a) == len(b) || b[len(a)] == '.') {
+		return true
 	}
 
-	if _, ok := pl.children[rootKey]; !ok {
-		layer := newPermissionLayer()
-		pl.children[rootKey] = &layer
+	// Different ranges of the same slice
+	parentA, segmentA := splitLastSegment(a)
+	parentB, segmentB := splitLastSegment(b)
+	if parentA != parentB {
+		return false
 	}
-	pl.children[rootKey].Add(keys[1:], newPerm)
+	rangeA, okA := rangeFromSegment(segmentA)
+	rangeB, okB := rangeFromSegment(segmentB)
+	return okA && okB && rangeA.overlaps(rangeB)
 }
 
-func (pl *permissionLayer) Clear(keys []string) {
-	if len(keys) == 0 {
-		panic("add should never be passed 0 keys")
+func splitLastSegment(path string) (string, string) {
+	i := strings.LastIndex(path, ".")
+	if i == -1 {
+		return "", path
 	}
+	return path[:i], path[i+1:]
+}
 
-	rootKey := keys[0]
+// Whether or not two permissions on overlapping paths can be held at the same
+// time. Readers share with readers and appenders share with appenders, while
+// writers share with no one.
+func permissionsCompatible(a, b PermissionType) bool {
+	return a == b && a != WritePermissionType
+}
 
-	if len(keys) == 1 {
-		if perm, ok := pl.permissions[rootKey]; ok {
-			if perm < 0 {
-				pl.permissions[rootKey] = 0
-			} else if perm > 0 {
-				pl.permissions[rootKey] = perm - 1
-			} else {
-				panic(fmt.Errorf("trying to clear permission %s that's already clear", rootKey))
+// Whether or not the two sets of permissions can not be held at the same time
+func permissionsConflict(a, b map[string]PermissionType) bool {
+	for pathA, permA := range a {
+		for pathB, permB := range b {
+			if permissionsCompatible(permA, permB) {
+				continue
+			}
+
+			if pathsOverlap(pathA, pathB) {
+				return true
 			}
-		} else {
-			panic(fmt.Errorf("trying to clear permission %s that's never been set", rootKey))
 		}
-		return
 	}
+	return false
+}
 
-	if layer, ok := pl.children[rootKey]; ok {
-		layer.Clear(keys[1:])
-	} else {
-		panic(fmt.Errorf("trying to clear permission %s that's never been set", keys))
+// Path of a permission within the set that conflicts with another permission
+// of the same set, if there is one
+func conflictWithin(permissions map[string]PermissionType) (string, bool) {
+	for pathA, permA := range permissions {
+		for pathB, permB := range permissions {
+			if pathA != pathB && !permissionsCompatible(permA, permB) && pathsOverlap(pathA, pathB) {
+				return pathA, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Whether or not the two sets of permissions touch the same data in a way
+// where the order they're granted in matters. Unlike permissionsConflict,
+// this includes appenders, as their appends are committed in the order they
+// were granted.
+func permissionsOrdered(a, b map[string]PermissionType) bool {
+	for pathA, permA := range a {
+		for pathB, permB := range b {
+			if permA == ReadPermissionType && permB == ReadPermissionType {
+				continue
+			}
+
+			if pathsOverlap(pathA, pathB) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Whether or not any of the permissions modify the data they refer to
+func permissionsWrite(permissions map[string]PermissionType) bool {
+	for _, perm := range permissions {
+		if perm != ReadPermissionType {
+			return true
+		}
+	}
+	return false
+}
+
+// FairnessPolicy determines the order in which commands waiting on the same
+// data are granted their permissions.
+type FairnessPolicy int
+
+const (
+	// FIFOFair grants permissions in the order they were requested. Readers
+	// requesting data after a writer queue up behind it.
+	FIFOFair FairnessPolicy = iota
+
+	// ReaderPreferred lets readers share data whenever no writer currently
+	// holds it, even if a writer has been waiting longer. A steady stream of
+	// readers can starve writers.
+	ReaderPreferred
+
+	// WriterPreferred lets writers go ahead of any readers waiting on the same
+	// data, and keeps new readers from starting while a writer is waiting. A
+	// steady stream of writers can starve readers.
+	WriterPreferred
+)
+
+// Whether or not permissions have to wait on other permissions that are also
+// waiting to be granted, given whether the others were requested first.
+func (f FairnessPolicy) queuesBehind(permissions, other map[string]PermissionType, otherFirst bool) bool {
+	if !permissionsOrdered(other, permissions) {
+		return false
+	}
+
+	switch f {
+	case ReaderPreferred:
+		// Readers only wait on whoever currently holds the data
+		return otherFirst && permissionsWrite(permissions)
+
+	case WriterPreferred:
+		// Writers go ahead of waiting readers, and readers wait on every
+		// waiting writer regardless of when it was requested
+		if !permissionsWrite(other) {
+			return false
+		}
+		return otherFirst || !permissionsWrite(permissions)
 	}
+
+	// Permissions touching the same data are granted in the order they were
+	// requested
+	return otherFirst
+}
+
+// Permissions someone is blocked on adding to the table
+type waitingPermissions struct {
+	ticket      int
+	permissions map[string]PermissionType
 }
 
+// ErrConflictingPermissions is returned when adding a set of permissions to
+// a table where some of the permissions conflict with others of the same set.
+var ErrConflictingPermissions = errors.New("permission conflicts with the rest of the block attempting to be added")
+
 // Thread safe collection of permissions
 type PermissionTable struct {
 	permissions permissionLayer
 	changes     int
 	lock        sync.RWMutex
+	fairness    FairnessPolicy
+
+	// Closed and replaced every time the table changes, waking up everyone
+	// waiting on the table
+	changed chan struct{}
+
+	// Callers of AddBlocking that new permissions might have to queue behind,
+	// ordered by ticket
+	waiting    []*waitingPermissions
+	nextTicket int
 }
 
 func NewPermissionTable() *PermissionTable {
+	return NewPermissionTableWithFairness(FIFOFair)
+}
+
+func NewPermissionTableWithFairness(fairness FairnessPolicy) *PermissionTable {
 	return &PermissionTable{
 		permissions: newPermissionLayer(),
+		fairness:    fairness,
+		changed:     make(chan struct{}),
+	}
+}
+
+// Assumes the caller holds the write lock
+func (pt *PermissionTable) unsafeIncrementVersion() {
+	pt.changes++
+	pt.unsafeNotify()
+}
+
+// Wakes up everyone waiting on the table. Assumes the caller holds the write
+// lock.
+func (pt *PermissionTable) unsafeNotify() {
+	close(pt.changed)
+	pt.changed = make(chan struct{})
+}
+
+// Channel closed the next time anyone waiting on the table should try again
+func (pt *PermissionTable) nextChange() <-chan struct{} {
+	pt.lock.RLock()
+	defer pt.lock.RUnlock()
+	return pt.changed
+}
+
+// Channel that is closed once the table's version no longer matches the
+// version provided.
+func (pt *PermissionTable) changedSince(version int) <-chan struct{} {
+	pt.lock.RLock()
+	defer pt.lock.RUnlock()
+	if pt.changes != version {
+		alreadyChanged := make(chan struct{})
+		close(alreadyChanged)
+		return alreadyChanged
+	}
+	return pt.changed
+}
+
+// Blocks until the table's version no longer matches the version provided,
+// or the context is done.
+func (pt *PermissionTable) WaitForChange(ctx context.Context, version int) error {
+	select {
+	case <-pt.changedSince(version):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Blocks until the permissions can be added to the table without conflict,
+// sleeping in between attempts until permissions have been cleared from the
+// table. Returns the context's error if it is done before the permissions can
+// be added.
+//
+// Depending on the table's fairness policy, permissions waiting to be added
+// hold up permissions requested after them that touch the same data.
+//
+// Returns ErrConflictingPermissions if the permissions conflict with one
+// another, as they could never be added.
+func (pt *PermissionTable) AddBlocking(ctx context.Context, newPermissions map[string]PermissionType) error {
+	if path, ok := conflictWithin(newPermissions); ok {
+		return fmt.Errorf("%w: %s", ErrConflictingPermissions, path)
+	}
+
+	waiting := pt.wait(newPermissions)
+	defer pt.stopWaiting(waiting)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Grab the channel before attempting to add so we don't miss a
+		// clear that happens in between
+		changed := pt.nextChange()
+		if pt.tryAdd(newPermissions, waiting.ticket) {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Registers the permissions as waiting to be added, so that permissions
+// requested later can queue behind them as the fairness policy requires.
+func (pt *PermissionTable) wait(permissions map[string]PermissionType) *waitingPermissions {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	waiting := &waitingPermissions{
+		ticket:      pt.nextTicket,
+		permissions: permissions,
+	}
+	pt.nextTicket++
+	pt.waiting = append(pt.waiting, waiting)
+	return waiting
+}
+
+func (pt *PermissionTable) stopWaiting(waiting *waitingPermissions) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	for i, other := range pt.waiting {
+		if other == waiting {
+			pt.waiting = append(pt.waiting[:i], pt.waiting[i+1:]...)
+
+			// Permissions queued behind these might be able to go now
+			pt.unsafeNotify()
+			return
+		}
+	}
+}
+
+// Assumes something else is utilizing the mutex to guarantee synchronization
+func (pt *PermissionTable) unsafeBlockedByWaiting(newPermissions map[string]PermissionType, ticket int) bool {
+	for _, waiting := range pt.waiting {
+		if waiting.ticket == ticket {
+			continue
+		}
+		if pt.fairness.queuesBehind(newPermissions, waiting.permissions, waiting.ticket < ticket) {
+			return true
+		}
 	}
+	return false
 }
 
 // Assumes something else is utilizing the mutex to guarantee synchronization
@@ -139,23 +465,32 @@ func (pt *PermissionTable) Version() int {
 	return pt.changes
 }
 
-// Atomic operation
+// Atomic operation. Panics if the permissions conflict with one another, as
+// they could never be added.
 func (pt *PermissionTable) TryAdd(newPermissions map[string]PermissionType) bool {
+	return pt.tryAdd(newPermissions, math.MaxInt)
+}
+
+// Adds the permissions as long as they neither conflict with the table nor
+// have to queue behind any other permissions waiting to be added, where the
+// ticket provided places them in line.
+func (pt *PermissionTable) tryAdd(newPermissions map[string]PermissionType, ticket int) bool {
+	// Checked up front so the table is never left holding part of the block
+	if path, ok := conflictWithin(newPermissions); ok {
+		panic(fmt.Errorf("%w: %s", ErrConflictingPermissions, path))
+	}
+
 	pt.lock.Lock()
 	defer pt.lock.Unlock()
 
-	if pt.unsafeConflict(newPermissions) {
+	if pt.unsafeConflict(newPermissions) || pt.unsafeBlockedByWaiting(newPermissions, ticket) {
 		return false
 	}
 
-	pt.changes++
+	pt.unsafeIncrementVersion()
 
 	for key, permission := range newPermissions {
-		keys := strings.Split(key, ".")
-		if pt.permissions.Conflict(keys, permission) {
-			panic(fmt.Errorf("%s permission conflicts with the rest of the block attempting to be added", key))
-		}
-		pt.permissions.Add(keys, permission)
+		pt.permissions.Add(strings.Split(key, "."), permission)
 	}
 	return true
 }
@@ -164,9 +499,33 @@ func (pt *PermissionTable) Clear(permissionsToClear map[string]PermissionType) {
 	pt.lock.Lock()
 	defer pt.lock.Unlock()
 
-	pt.changes++
+	pt.unsafeIncrementVersion()
+
+	for key, permission := range permissionsToClear {
+		pt.permissions.Clear(strings.Split(key, "."), permission)
+	}
+}
+
+// Atomically swaps out the permissions held for a set of permissions that
+// are each contained within them, such that nothing else can sneak in
+// between.
+func (pt *PermissionTable) exchange(held map[string]PermissionType, replacements []map[string]PermissionType) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
 
-	for key := range permissionsToClear {
-		pt.permissions.Clear(strings.Split(key, "."))
+	pt.unsafeIncrementVersion()
+
+	for key, permission := range held {
+		pt.permissions.Clear(strings.Split(key, "."), permission)
+	}
+
+	for _, replacement := range replacements {
+		for key, permission := range replacement {
+			keys := strings.Split(key, ".")
+			if pt.permissions.Conflict(keys, permission) {
+				panic(fmt.Errorf("%s permission conflicts with the rest of the permissions being exchanged", key))
+			}
+			pt.permissions.Add(keys, permission)
+		}
 	}
 }
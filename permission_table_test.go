@@ -1,7 +1,11 @@
 package quill_test
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/EliCDavis/quill"
 	"github.com/stretchr/testify/assert"
@@ -79,6 +83,182 @@ func TestPermissionTable_Conflicts(t *testing.T) {
 				"baseRead.sub": quill.ReadPermissionType,
 			},
 		},
+		"write(a) on read(a.b): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"something": quill.WritePermissionType,
+			},
+		},
+		"read(a) on read(a.b): no conflict": {
+			conflicts: false,
+			input: map[string]quill.PermissionType{
+				"something": quill.ReadPermissionType,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.conflicts, table.Conflicts(tc.input))
+		})
+	}
+}
+
+func TestPermissionTable_Ranges(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	added := table.TryAdd(map[string]quill.PermissionType{
+		"arr.[0:50]":   quill.WritePermissionType,
+		"other.[10:]":  quill.ReadPermissionType,
+		"other.[0:10]": quill.WritePermissionType,
+	})
+
+	// ACT / ASSERT ===========================================================
+	assert.True(t, added)
+
+	tests := map[string]struct {
+		input     map[string]quill.PermissionType
+		conflicts bool
+	}{
+		"write(disjoint range) on write(range): no conflict": {
+			conflicts: false,
+			input: map[string]quill.PermissionType{
+				"arr.[50:100]": quill.WritePermissionType,
+			},
+		},
+		"read(overlapping range) on write(range): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"arr.[49:100]": quill.ReadPermissionType,
+			},
+		},
+		"read(whole slice) on write(range): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"arr": quill.ReadPermissionType,
+			},
+		},
+		"read(overlapping range) on read(open range): no conflict": {
+			conflicts: false,
+			input: map[string]quill.PermissionType{
+				"other.[50:60]": quill.ReadPermissionType,
+			},
+		},
+		"write(range) within open range: conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"other.[500:600]": quill.WritePermissionType,
+			},
+		},
+		"write(empty range): no conflict": {
+			conflicts: false,
+			input: map[string]quill.PermissionType{
+				"arr.[10:10]": quill.WritePermissionType,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.conflicts, table.Conflicts(tc.input))
+		})
+	}
+}
+
+func TestPermissionTable_Appends(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	added := table.TryAdd(map[string]quill.PermissionType{
+		"arr": quill.AppendPermissionType,
+	})
+
+	// ACT / ASSERT ===========================================================
+	assert.True(t, added)
+
+	tests := map[string]struct {
+		input     map[string]quill.PermissionType
+		conflicts bool
+	}{
+		"append(a) on append(a): no conflict": {
+			conflicts: false,
+			input: map[string]quill.PermissionType{
+				"arr": quill.AppendPermissionType,
+			},
+		},
+		"read(a) on append(a): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"arr": quill.ReadPermissionType,
+			},
+		},
+		"write(a) on append(a): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"arr": quill.WritePermissionType,
+			},
+		},
+		"read(a.[0:5]) on append(a): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"arr.[0:5]": quill.ReadPermissionType,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.conflicts, table.Conflicts(tc.input))
+		})
+	}
+}
+
+func TestPermissionTable_Accumulators(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	added := table.TryAdd(map[string]quill.PermissionType{
+		"stats.count": quill.AccumulatePermissionType,
+	})
+
+	// ACT / ASSERT ===========================================================
+	assert.True(t, added)
+
+	tests := map[string]struct {
+		input     map[string]quill.PermissionType
+		conflicts bool
+	}{
+		"accumulate(a.b) on accumulate(a.b): no conflict": {
+			conflicts: false,
+			input: map[string]quill.PermissionType{
+				"stats.count": quill.AccumulatePermissionType,
+			},
+		},
+		"read(a.b) on accumulate(a.b): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"stats.count": quill.ReadPermissionType,
+			},
+		},
+		"write(a.b) on accumulate(a.b): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"stats.count": quill.WritePermissionType,
+			},
+		},
+		"append(a.b) on accumulate(a.b): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"stats.count": quill.AppendPermissionType,
+			},
+		},
+		"read(a) on accumulate(a.b): conflict": {
+			conflicts: true,
+			input: map[string]quill.PermissionType{
+				"stats": quill.ReadPermissionType,
+			},
+		},
+		"accumulate(a.c) on accumulate(a.b): no conflict": {
+			conflicts: false,
+			input: map[string]quill.PermissionType{
+				"stats.total": quill.AccumulatePermissionType,
+			},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -86,3 +266,354 @@ func TestPermissionTable_Conflicts(t *testing.T) {
 		})
 	}
 }
+
+func TestPermissionTable_AddBlocking(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	write := map[string]quill.PermissionType{
+		"something": quill.WritePermissionType,
+	}
+	table.TryAdd(write)
+	added := make(chan error)
+
+	// ACT ====================================================================
+	go func() {
+		added <- table.AddBlocking(context.Background(), write)
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("permissions were added while conflicting")
+	case <-time.After(10 * time.Millisecond):
+	}
+	table.Clear(write)
+
+	// ASSERT =================================================================
+	assert.NoError(t, <-added)
+	assert.True(t, table.Conflicts(write))
+}
+
+func TestPermissionTable_AddBlocking_ContextCancelled(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	write := map[string]quill.PermissionType{
+		"something": quill.WritePermissionType,
+	}
+	table.TryAdd(write)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// ACT ====================================================================
+	err := table.AddBlocking(ctx, write)
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, table.Version())
+}
+
+func TestPermissionTable_AddBlocking_ConflictsWithItself(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	permissions := map[string]quill.PermissionType{
+		"a":   quill.ReadPermissionType,
+		"a.b": quill.WritePermissionType,
+	}
+
+	// ACT ====================================================================
+	err := table.AddBlocking(context.Background(), permissions)
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, err, quill.ErrConflictingPermissions)
+	assert.False(t, table.Conflicts(map[string]quill.PermissionType{
+		"a": quill.WritePermissionType,
+	}), "nothing should have been added")
+}
+
+func TestPermissionTable_AddBlocking_Fairness(t *testing.T) {
+	tests := map[string]struct {
+		fairness       quill.FairnessPolicy
+		readerAdmitted bool
+	}{
+		"fifo: new readers queue behind waiting writer": {
+			fairness:       quill.FIFOFair,
+			readerAdmitted: false,
+		},
+		"reader preferred: new readers pass waiting writer": {
+			fairness:       quill.ReaderPreferred,
+			readerAdmitted: true,
+		},
+		"writer preferred: new readers queue behind waiting writer": {
+			fairness:       quill.WriterPreferred,
+			readerAdmitted: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			table := quill.NewPermissionTableWithFairness(tc.fairness)
+			read := map[string]quill.PermissionType{
+				"something": quill.ReadPermissionType,
+			}
+			write := map[string]quill.PermissionType{
+				"something": quill.WritePermissionType,
+			}
+			table.TryAdd(read)
+			added := make(chan error)
+			go func() {
+				added <- table.AddBlocking(context.Background(), write)
+			}()
+			time.Sleep(10 * time.Millisecond)
+
+			// ACT ============================================================
+			readerAdmitted := table.TryAdd(read)
+
+			// ASSERT =========================================================
+			assert.Equal(t, tc.readerAdmitted, readerAdmitted)
+
+			table.Clear(read)
+			if readerAdmitted {
+				table.Clear(read)
+			}
+			assert.NoError(t, <-added)
+			assert.True(t, table.Conflicts(read))
+		})
+	}
+}
+
+func TestPermissionTable_AddBlocking_FairnessWithReaderWaiting(t *testing.T) {
+	tests := map[string]struct {
+		fairness    quill.FairnessPolicy
+		writerFirst bool
+	}{
+		"fifo: waiting reader goes before later writer": {
+			fairness:    quill.FIFOFair,
+			writerFirst: false,
+		},
+		"reader preferred: waiting reader goes before later writer": {
+			fairness:    quill.ReaderPreferred,
+			writerFirst: false,
+		},
+		"writer preferred: later writer goes before waiting reader": {
+			fairness:    quill.WriterPreferred,
+			writerFirst: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			table := quill.NewPermissionTableWithFairness(tc.fairness)
+			read := map[string]quill.PermissionType{
+				"something": quill.ReadPermissionType,
+			}
+			write := map[string]quill.PermissionType{
+				"something": quill.WritePermissionType,
+			}
+			table.TryAdd(write)
+
+			admitted := make(chan string, 2)
+			go func() {
+				assert.NoError(t, table.AddBlocking(context.Background(), read))
+				admitted <- "reader"
+			}()
+			time.Sleep(10 * time.Millisecond)
+			go func() {
+				assert.NoError(t, table.AddBlocking(context.Background(), write))
+				admitted <- "writer"
+			}()
+			time.Sleep(10 * time.Millisecond)
+
+			// ACT ============================================================
+			table.Clear(write)
+			first := <-admitted
+
+			// ASSERT =========================================================
+			if tc.writerFirst {
+				assert.Equal(t, "writer", first)
+				table.Clear(write)
+				assert.Equal(t, "reader", <-admitted)
+				table.Clear(read)
+			} else {
+				assert.Equal(t, "reader", first)
+				table.Clear(read)
+				assert.Equal(t, "writer", <-admitted)
+				table.Clear(write)
+			}
+		})
+	}
+}
+
+func TestPermissionTable_WaitForChange(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	version := table.Version()
+
+	// ACT ====================================================================
+	table.TryAdd(map[string]quill.PermissionType{
+		"something": quill.ReadPermissionType,
+	})
+
+	// ASSERT =================================================================
+	assert.NoError(t, table.WaitForChange(context.Background(), version))
+}
+
+func TestPermissionTable_DescendantWriteBlocksAncestor(t *testing.T) {
+	// ARRANGE ================================================================
+	table := quill.NewPermissionTable()
+	child := map[string]quill.PermissionType{
+		"Sub.IntArr": quill.WritePermissionType,
+	}
+	parent := map[string]quill.PermissionType{
+		"Sub": quill.ReadPermissionType,
+	}
+	assert.True(t, table.TryAdd(child))
+
+	// ACT ====================================================================
+	addedWhileChildHeld := table.TryAdd(parent)
+	table.Clear(child)
+	addedAfterChildCleared := table.TryAdd(parent)
+
+	// ASSERT =================================================================
+	assert.False(t, addedWhileChildHeld)
+	assert.True(t, addedAfterChildCleared)
+	assert.True(t, table.Conflicts(child))
+}
+
+// Interprets segments like "[2:5]" as the interval they describe
+func fuzzRange(segment string) (int, int, bool) {
+	var start, end int
+	if _, err := fmt.Sscanf(segment, "[%d:%d]", &start, &end); err != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// Independent of the table's implementation, whether or not one path refers
+// to data also referred to by the other.
+func fuzzPathsOverlap(a, b string) bool {
+	segmentsA := strings.Split(a, ".")
+	segmentsB := strings.Split(b, ".")
+	for i := 0; i < len(segmentsA) && i < len(segmentsB); i++ {
+		if segmentsA[i] == segmentsB[i] {
+			continue
+		}
+
+		startA, endA, okA := fuzzRange(segmentsA[i])
+		startB, endB, okB := fuzzRange(segmentsB[i])
+		return okA && okB && startA < endB && startB < endA
+	}
+	return true
+}
+
+// Independent of the table's implementation, whether or not the two sets of
+// permissions overlap on some path they can't share. Only readers share with
+// readers, and appenders with appenders.
+func permissionSetsOverlap(a, b map[string]quill.PermissionType) bool {
+	for pathA, permA := range a {
+		for pathB, permB := range b {
+			if permA == permB && permA != quill.WritePermissionType {
+				continue
+			}
+
+			if fuzzPathsOverlap(pathA, pathB) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func FuzzPermissionTable(f *testing.F) {
+	paths := []string{"a", "a.b", "a.b.c", "a.d", "e", "e.f", "e.[0:5]", "e.[3:8]", "e.[5:10]"}
+
+	f.Add([]byte{1, 0, 1, 1, 0, 0, 1, 2})
+	f.Add([]byte{1, 0x42, 1, 0x81, 1, 0x0c, 0, 1, 1, 0x42})
+	f.Add([]byte{1, 0x40, 1, 0x02, 1, 0x43, 0, 0, 0, 0, 1, 0x40})
+	f.Add([]byte{7, 0x06, 7, 0x06, 1, 0x06, 31, 0x10, 0, 0, 7, 0x00})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		table := quill.NewPermissionTable()
+		admitted := make([]map[string]quill.PermissionType, 0)
+
+		for i := 0; i+1 < len(ops); i += 2 {
+			op, arg := ops[i], ops[i+1]
+
+			// Clear a previously admitted set of permissions
+			if op%2 == 0 {
+				if len(admitted) == 0 {
+					continue
+				}
+				index := int(arg) % len(admitted)
+				table.Clear(admitted[index])
+				admitted = append(admitted[:index], admitted[index+1:]...)
+				continue
+			}
+
+			// Attempt to admit up to two permissions
+			permissions := make(map[string]quill.PermissionType)
+			for _, choice := range []struct {
+				path   string
+				write  bool
+				append bool
+			}{
+				{path: paths[int(arg)%len(paths)], write: arg&0x40 != 0, append: (op>>1)%4 == 3},
+				{path: paths[int(arg/8)%len(paths)], write: arg&0x80 != 0, append: (op>>3)%4 == 3},
+			} {
+				perm := quill.ReadPermissionType
+				if choice.write {
+					perm = quill.WritePermissionType
+				} else if choice.append {
+					perm = quill.AppendPermissionType
+				}
+
+				// Asking for the same path twice in different ways is the same
+				// as asking to write to it
+				if existing, ok := permissions[choice.path]; ok && existing != perm {
+					perm = quill.WritePermissionType
+				}
+				permissions[choice.path] = perm
+			}
+
+			// The table refuses blocks that conflict with themselves
+			selfConflicting := false
+			for path, perm := range permissions {
+				for otherPath, otherPerm := range permissions {
+					single := map[string]quill.PermissionType{path: perm}
+					other := map[string]quill.PermissionType{otherPath: otherPerm}
+					if path != otherPath && permissionSetsOverlap(single, other) {
+						selfConflicting = true
+					}
+				}
+			}
+			if selfConflicting {
+				continue
+			}
+
+			expectConflict := false
+			for _, held := range admitted {
+				if permissionSetsOverlap(permissions, held) {
+					expectConflict = true
+				}
+			}
+
+			if table.Conflicts(permissions) != expectConflict {
+				t.Fatalf("expected conflict %t for %v against %v", expectConflict, permissions, admitted)
+			}
+			if table.TryAdd(permissions) == expectConflict {
+				t.Fatalf("expected admission %t for %v against %v", !expectConflict, permissions, admitted)
+			}
+			if !expectConflict {
+				admitted = append(admitted, permissions)
+			}
+
+			for x := range admitted {
+				for y := x + 1; y < len(admitted); y++ {
+					if permissionSetsOverlap(admitted[x], admitted[y]) {
+						t.Fatalf("overlapping permissions admitted: %v and %v", admitted[x], admitted[y])
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package quill
+
+import "context"
+
+// Command that produces a result once it has ran
+type resultCommand[R any] interface {
+	Command
+	result() R
+}
+
+// QueryCommand is a ViewCommand whose action returns a result, made available
+// through the ResultFuture returned by SubmitQuery.
+type QueryCommand[T, R any] struct {
+	populatedData T
+	Action        func(*T) (R, error)
+	value         R
+}
+
+func (qc *QueryCommand[T, R]) Run() error {
+	value, err := qc.Action(&qc.populatedData)
+	qc.value = value
+	return err
+}
+
+func (qc *QueryCommand[T, R]) run(ctx context.Context) error {
+	return qc.Run()
+}
+
+func (qc *QueryCommand[T, R]) data() any {
+	return &qc.populatedData
+}
+
+// View the query is ran with, for setting up permissions such as MapKeys
+// ahead of submitting the query.
+func (qc *QueryCommand[T, R]) View() *T {
+	return &qc.populatedData
+}
+
+func (qc *QueryCommand[T, R]) result() R {
+	return qc.value
+}
+
+// ResultFuture is a Future for a command that produces a result.
+type ResultFuture[R any] struct {
+	*Future
+	command resultCommand[R]
+}
+
+// Blocks until the command has finished, returning its result. The result is
+// the zero value of R if the command failed.
+func (rf *ResultFuture[R]) Result() (R, error) {
+	if err := rf.Wait(); err != nil {
+		var zero R
+		return zero, err
+	}
+	return rf.command.result(), nil
+}
+
+func submitForResult[T, R any](ctx context.Context, ds *DataSource[T], command resultCommand[R]) *ResultFuture[R] {
+	return &ResultFuture[R]{
+		Future:  ds.SubmitContext(ctx, command),
+		command: command,
+	}
+}
+
+// Submits the query to the data source, returning a future for its result.
+// A query must not be submitted again until its result has been retrieved.
+func SubmitQuery[T, V, R any](ds *DataSource[T], command *QueryCommand[V, R]) *ResultFuture[R] {
+	return submitForResult[T, R](context.Background(), ds, command)
+}
+
+// Same as SubmitQuery, except the query is not started if the context is done
+// before it gets the chance to.
+func SubmitQueryContext[T, V, R any](ctx context.Context, ds *DataSource[T], command *QueryCommand[V, R]) *ResultFuture[R] {
+	return submitForResult[T, R](ctx, ds, command)
+}
+
+// Submits the map reduce to the data source, returning a future for its
+// reduced result. A map reduce must not be submitted again until its result
+// has been retrieved.
+func SubmitMapReduce[T, E, R any](ds *DataSource[T], command *MapReduceCommand[E, R]) *ResultFuture[R] {
+	return submitForResult[T, R](context.Background(), ds, command)
+}
+
+// Same as SubmitMapReduce, except the map reduce is not started if the
+// context is done before it gets the chance to.
+func SubmitMapReduceContext[T, E, R any](ctx context.Context, ds *DataSource[T], command *MapReduceCommand[E, R]) *ResultFuture[R] {
+	return submitForResult[T, R](ctx, ds, command)
+}
@@ -0,0 +1,66 @@
+package quill_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryCommand_Result(t *testing.T) {
+	// ARRANGE ================================================================
+	type SumView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+	}, quill.WithPoolSize(4))
+	sum := func(view *SumView) (float64, error) {
+		total := 0.
+		values := view.FloatArr.Value()
+		for i := 0; i < values.Len(); i++ {
+			total += values.At(i)
+		}
+		return total, nil
+	}
+
+	// ACT ====================================================================
+	first := quill.SubmitQuery(dataSource, &quill.QueryCommand[SumView, float64]{Action: sum})
+	second := quill.SubmitQuery(dataSource, &quill.QueryCommand[SumView, float64]{Action: sum})
+	firstSum, firstErr := first.Result()
+	secondSum, secondErr := second.Result()
+
+	// ASSERT =================================================================
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, 6., firstSum)
+	assert.Equal(t, 6., secondSum)
+	assert.NoError(t, quill.WaitAll(first.Future, second.Future))
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestQueryCommand_FailedQueryHasZeroResult(t *testing.T) {
+	// ARRANGE ================================================================
+	type StrView struct {
+		Sub struct {
+			Str *quill.ItemReadPermission[string]
+		}
+	}
+
+	dataSource := quill.NewDataSource(NastyData{})
+	errQuery := errors.New("query failed")
+
+	// ACT ====================================================================
+	result, err := quill.SubmitQuery(dataSource, &quill.QueryCommand[StrView, string]{
+		Action: func(view *StrView) (string, error) {
+			return "partial", errQuery
+		},
+	}).Result()
+
+	// ASSERT =================================================================
+	assert.ErrorIs(t, err, errQuery)
+	assert.Equal(t, "", result)
+	assert.ErrorIs(t, dataSource.Close(), errQuery)
+}
@@ -63,27 +63,30 @@ func (rcp CollectionReadPermission) Data() any {
 	return rcp.data
 }
 
-func (rcp CollectionReadPermission) Populate(newData any) {
-	rcp.inject(reflect.ValueOf(newData))
+func (rcp CollectionReadPermission) Populate(newData any) error {
+	return rcp.inject(reflect.ValueOf(newData))
 }
 
-func (rcp CollectionReadPermission) inject(val reflect.Value) {
+func (rcp CollectionReadPermission) inject(val reflect.Value) error {
 	kind := val.Kind()
 	if kind == reflect.Pointer {
-		panic("collections can not be populated with pointers yet")
+		return fmt.Errorf("collections can not be populated with pointers yet")
 	}
 
 	if kind != reflect.Struct {
-		panic(fmt.Errorf("collections can not be populated by %s", kind.String()))
+		return fmt.Errorf("collections can not be populated by %s", kind.String())
 	}
 
 	for key, perm := range rcp.data {
 		field, ok := getValueByName(val, key)
 		if !ok {
-			panic(fmt.Errorf("struct does not contain a field named: '%s' to populate collection", key))
+			return fmt.Errorf("struct does not contain a field named: '%s' to populate collection", key)
+		}
+		if err := perm.inject(field); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
 		}
-		perm.inject(field)
 	}
+	return nil
 }
 
 func (rcp CollectionReadPermission) clear() {
@@ -106,13 +109,13 @@ func (rdep ArrayReadPermission[T]) Value() *iter.ArrayIterator[T] {
 	return iter.Array[T](rdep.data)
 }
 
-func (rdep *ArrayReadPermission[T]) inject(val reflect.Value) {
-	t := val.Kind()
-	if t != reflect.Slice {
-		panic(fmt.Errorf("can not populate an array permission with value of type: %s", t.String()))
+func (rdep *ArrayReadPermission[T]) inject(val reflect.Value) error {
+	data, err := sliceFromValue[T](val)
+	if err != nil {
+		return err
 	}
-
-	rdep.data = val.Interface().([]T)
+	rdep.data = data
+	return nil
 }
 
 func (rdep *ArrayReadPermission[T]) clear() {
@@ -123,6 +126,105 @@ func (rdep ArrayReadPermission[T]) Type() PermissionType {
 	return ReadPermissionType
 }
 
+// ARRAY SLICE ================================================================
+
+// ArraySliceReadPermission grants a command read access to a range of a slice
+// within the source, declared on the view with a range tag:
+//
+//	FirstHalf *quill.ArraySliceReadPermission[float64] `quill:"FloatArr" range:"0:50"`
+//
+// Without a range tag the permission covers the entire slice.
+type ArraySliceReadPermission[T any] struct {
+	data  []T
+	start int
+}
+
+// Elements of the slice within the range
+func (asrp ArraySliceReadPermission[T]) Value() *iter.ArrayIterator[T] {
+	return iter.Array[T](asrp.data)
+}
+
+// Index within the source's slice the range starts at
+func (asrp ArraySliceReadPermission[T]) Start() int {
+	return asrp.start
+}
+
+func (asrp *ArraySliceReadPermission[T]) inject(val reflect.Value) error {
+	return asrp.injectRange(val, 0)
+}
+
+func (asrp *ArraySliceReadPermission[T]) injectRange(val reflect.Value, start int) error {
+	data, err := sliceFromValue[T](val)
+	if err != nil {
+		return err
+	}
+	asrp.data = data
+	asrp.start = start
+	return nil
+}
+
+func (asrp *ArraySliceReadPermission[T]) clear() {
+	asrp.data = nil
+	asrp.start = 0
+}
+
+func (asrp ArraySliceReadPermission[T]) Type() PermissionType {
+	return ReadPermissionType
+}
+
+// MAP ========================================================================
+
+// MapReadPermission grants a command read access to an entire map within the
+// source, for when the keys a command needs aren't known ahead of time.
+type MapReadPermission[K comparable, V any] struct {
+	data map[K]V
+}
+
+func (mrp MapReadPermission[K, V]) Get(key K) (V, bool) {
+	v, ok := mrp.data[key]
+	return v, ok
+}
+
+func (mrp MapReadPermission[K, V]) Len() int {
+	return len(mrp.data)
+}
+
+// Keys of every entry in the map, in no particular order
+func (mrp MapReadPermission[K, V]) Keys() []K {
+	keys := make([]K, 0, len(mrp.data))
+	for k := range mrp.data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Calls the function with every entry in the map, in no particular order,
+// stopping early if the function returns false
+func (mrp MapReadPermission[K, V]) Range(f func(key K, value V) bool) {
+	for k, v := range mrp.data {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+func (mrp *MapReadPermission[K, V]) inject(val reflect.Value) error {
+	data, err := mapFromValue[K, V](val)
+	if err != nil {
+		return err
+	}
+	mrp.data = data
+	return nil
+}
+
+func (mrp *MapReadPermission[K, V]) clear() {
+	mrp.data = nil
+}
+
+func (mrp MapReadPermission[K, V]) Type() PermissionType {
+	return ReadPermissionType
+}
+
 // ITEM =======================================================================
 
 type ItemReadPermission[T any] struct {
@@ -133,8 +235,13 @@ func (itp ItemReadPermission[T]) Value() T {
 	return itp.data
 }
 
-func (itp *ItemReadPermission[T]) inject(val reflect.Value) {
-	itp.data = val.Interface().(T)
+func (itp *ItemReadPermission[T]) inject(val reflect.Value) error {
+	data, err := itemFromValue[T](val)
+	if err != nil {
+		return err
+	}
+	itp.data = data
+	return nil
 }
 
 func (itp *ItemReadPermission[T]) clear() {
@@ -145,3 +252,65 @@ func (itp *ItemReadPermission[T]) clear() {
 func (itp ItemReadPermission[T]) Type() PermissionType {
 	return ReadPermissionType
 }
+
+// SNAPSHOT ===================================================================
+
+// Permission that keeps reading the data it was populated with after giving
+// up its access to the source
+type snapshotPermission interface {
+	Permission
+
+	useSnapshot(version uint64)
+}
+
+// SnapshotReadPermission grants a command a snapshot of a field within the
+// source as it was when the command started. The command only holds onto the
+// field long enough to be populated, so commands writing to the field don't
+// have to wait for the command to finish.
+//
+// Snapshots are copied on write. Commands read the field itself until a
+// command writing to it is granted access, at which point the field is copied
+// and the writer is handed the copy, leaving the snapshot's readers as the
+// only ones with the original. The original is garbage collected once the
+// last of them finishes.
+//
+// The snapshot is shared, and must not be modified.
+type SnapshotReadPermission[T any] struct {
+	data    T
+	version uint64
+}
+
+func (srp SnapshotReadPermission[T]) Value() T {
+	return srp.data
+}
+
+// Identifies the snapshot, where commands given the same version were given
+// the same snapshot. Zero if the permission was populated outside of a data
+// source's scheduler, in which case Value is the field itself.
+func (srp SnapshotReadPermission[T]) Version() uint64 {
+	return srp.version
+}
+
+func (srp *SnapshotReadPermission[T]) inject(val reflect.Value) error {
+	data, err := itemFromValue[T](val)
+	if err != nil {
+		return err
+	}
+	srp.data = data
+	srp.version = 0
+	return nil
+}
+
+func (srp *SnapshotReadPermission[T]) useSnapshot(version uint64) {
+	srp.version = version
+}
+
+func (srp *SnapshotReadPermission[T]) clear() {
+	var data T
+	srp.data = data
+	srp.version = 0
+}
+
+func (srp SnapshotReadPermission[T]) Type() PermissionType {
+	return ReadPermissionType
+}
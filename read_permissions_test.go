@@ -1,7 +1,10 @@
 package quill_test
 
 import (
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/EliCDavis/quill"
 	"github.com/stretchr/testify/assert"
@@ -111,3 +114,480 @@ func TestView(t *testing.T) {
 		assert.Equal(t, "Test String", view.Sub.Str.Value())
 	}
 }
+
+func TestView_MismatchedTypes(t *testing.T) {
+	tests := map[string]struct {
+		view       any
+		path       string
+		viewKind   reflect.Kind
+		sourceKind reflect.Kind
+	}{
+		"array permission on string": {
+			view: &struct {
+				Sub struct {
+					Str *quill.ArrayReadPermission[string]
+				}
+			}{},
+			path:       ".Sub.Str",
+			viewKind:   reflect.Pointer,
+			sourceKind: reflect.String,
+		},
+		"array permission of wrong type": {
+			view: &struct {
+				FloatArr *quill.ArrayReadPermission[int]
+			}{},
+			path:       ".FloatArr",
+			viewKind:   reflect.Pointer,
+			sourceKind: reflect.Slice,
+		},
+		"item permission of wrong type": {
+			view: &struct {
+				Sub struct {
+					Str *quill.ItemReadPermission[int]
+				}
+			}{},
+			path:       ".Sub.Str",
+			viewKind:   reflect.Pointer,
+			sourceKind: reflect.String,
+		},
+		"struct on slice": {
+			view: &struct {
+				StrArr struct{}
+			}{},
+			path:       ".StrArr",
+			viewKind:   reflect.Struct,
+			sourceKind: reflect.Slice,
+		},
+		"pointer that is not a permission": {
+			view: &struct {
+				FloatArr *[]float64
+			}{},
+			path:       ".FloatArr",
+			viewKind:   reflect.Pointer,
+			sourceKind: reflect.Slice,
+		},
+		"range on item permission": {
+			view: &struct {
+				Sub struct {
+					Str *quill.ItemReadPermission[string] `range:"0:1"`
+				}
+			}{},
+			path:       ".Sub.Str",
+			viewKind:   reflect.Pointer,
+			sourceKind: reflect.String,
+		},
+		"malformed range": {
+			view: &struct {
+				FloatArr *quill.ArraySliceReadPermission[float64] `range:"5"`
+			}{},
+			path:       ".FloatArr",
+			viewKind:   reflect.Pointer,
+			sourceKind: reflect.Invalid,
+		},
+		"range out of bounds": {
+			view: &struct {
+				FloatArr *quill.ArraySliceReadPermission[float64] `range:"0:5"`
+			}{},
+			path:       ".FloatArr",
+			viewKind:   reflect.Pointer,
+			sourceKind: reflect.Slice,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := quill.PopulateView(NastyData{}, tc.view)
+
+			var viewErr quill.ViewError
+			if assert.ErrorAs(t, err, &viewErr) {
+				assert.Equal(t, tc.path, viewErr.Path)
+				assert.Equal(t, tc.viewKind, viewErr.ViewKind)
+				assert.Equal(t, tc.sourceKind, viewErr.SourceKind)
+			}
+		})
+	}
+}
+
+func TestView_FieldsAccessingTheSameData(t *testing.T) {
+	tests := map[string]struct {
+		view any
+		path string
+	}{
+		"slice and permission on the same field": {
+			view: &struct {
+				W []float64                           `quill:"FloatArr"`
+				R *quill.ArrayReadPermission[float64] `quill:"FloatArr"`
+			}{},
+			path: ".R",
+		},
+		"two permissions on the same field": {
+			view: &struct {
+				Sub struct {
+					A *quill.ItemReadPermission[string] `quill:"Str"`
+					B *quill.WritePermission[string]    `quill:"Str"`
+				}
+			}{},
+			path: ".Sub.B",
+		},
+		"permission on a field and the struct containing it": {
+			view: &struct {
+				Whole *quill.ItemReadPermission[struct {
+					IntArr []int
+					Str    string
+				}] `quill:"Sub"`
+				Sub struct {
+					IntArr []int
+				}
+			}{},
+			path: ".Sub.IntArr",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := quill.PopulateView(NastyData{}, tc.view)
+
+			var viewErr quill.ViewError
+			if assert.ErrorAs(t, err, &viewErr) {
+				assert.Equal(t, tc.path, viewErr.Path)
+				assert.Contains(t, viewErr.Reason, "already accessed by another field")
+			}
+		})
+	}
+}
+
+func TestMapReadPermission(t *testing.T) {
+	// ARRANGE ================================================================
+	type ColumnsView struct {
+		Columns *quill.MapReadPermission[string, []float64]
+	}
+	source := struct {
+		Columns map[string][]float64
+	}{
+		Columns: map[string][]float64{
+			"BasePrice": {10, 20},
+			"TaxRate":   {.2, .1},
+		},
+	}
+	view := ColumnsView{}
+
+	// ACT ====================================================================
+	_, err := quill.PopulateView(source, &view)
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, 2, view.Columns.Len())
+	assert.ElementsMatch(t, []string{"BasePrice", "TaxRate"}, view.Columns.Keys())
+
+	basePrice, ok := view.Columns.Get("BasePrice")
+	assert.True(t, ok)
+	assert.Equal(t, []float64{10, 20}, basePrice)
+
+	_, ok = view.Columns.Get("Missing")
+	assert.False(t, ok)
+
+	visited := 0
+	view.Columns.Range(func(key string, value []float64) bool {
+		visited++
+		return false
+	})
+	assert.Equal(t, 1, visited)
+}
+
+func TestSnapshotReadPermission_WritersDontWait(t *testing.T) {
+	// ARRANGE ================================================================
+	type SnapshotView struct {
+		FloatArr *quill.SnapshotReadPermission[[]float64]
+	}
+	type WriteView struct {
+		FloatArr []float64
+	}
+
+	data := &NastyData{FloatArr: []float64{1, 2, 3}}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	written := make(chan struct{})
+	var seen []float64
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		// Doesn't finish until the writer submitted after it has, which only
+		// ever happens if the writer doesn't wait on it
+		&quill.ViewCommand[SnapshotView]{
+			Action: func(view *SnapshotView) error {
+				select {
+				case <-written:
+				case <-time.After(time.Second):
+					return assert.AnError
+				}
+				seen = append(seen, view.FloatArr.Value()...)
+				return nil
+			},
+		},
+		&quill.ViewCommand[WriteView]{
+			Action: func(view *WriteView) error {
+				view.FloatArr[0] = 10
+				close(written)
+				return nil
+			},
+		},
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []float64{1, 2, 3}, seen)
+	assert.Equal(t, []float64{10, 2, 3}, data.FloatArr)
+}
+
+func TestSnapshotReadPermission_Versions(t *testing.T) {
+	// ARRANGE ================================================================
+	type SnapshotView struct {
+		Sub struct {
+			Str *quill.SnapshotReadPermission[string]
+		}
+	}
+	type WriteView struct {
+		Sub struct {
+			Str *quill.WritePermission[string]
+		}
+	}
+
+	data := &NastyData{}
+	data.Sub.Str = "first"
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+	readers := sync.WaitGroup{}
+	readers.Add(2)
+	versions := make([]uint64, 3)
+	values := make([]string, 3)
+	reader := func(i int, rendezvous bool) quill.Command {
+		return &quill.ViewCommand[SnapshotView]{
+			Action: func(view *SnapshotView) error {
+				versions[i] = view.Sub.Str.Version()
+				values[i] = view.Sub.Str.Value()
+
+				// Keep the first two readers running at the same time so
+				// they share a snapshot
+				if rendezvous {
+					readers.Done()
+					readers.Wait()
+				}
+				return nil
+			},
+		}
+	}
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		reader(0, true),
+		reader(1, true),
+		&quill.ViewCommand[WriteView]{
+			Action: func(view *WriteView) error {
+				view.Sub.Str.Write("second")
+				return nil
+			},
+		},
+		reader(2, false),
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []string{"first", "first", "second"}, values)
+	assert.NotZero(t, versions[0])
+	assert.Equal(t, versions[0], versions[1])
+	assert.NotEqual(t, versions[0], versions[2])
+}
+
+func TestSnapshotReadPermission_PopulateView(t *testing.T) {
+	// ARRANGE ================================================================
+	type SnapshotView struct {
+		FloatArr *quill.SnapshotReadPermission[[]float64]
+	}
+	data := NastyData{FloatArr: []float64{1, 2}}
+	view := SnapshotView{}
+
+	// ACT ====================================================================
+	_, err := quill.PopulateView(data, &view)
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 2}, view.FloatArr.Value())
+	assert.Zero(t, view.FloatArr.Version())
+}
+
+func TestSnapshotReadPermission_OnlyCopiesOnWrite(t *testing.T) {
+	// ARRANGE ================================================================
+	type SnapshotView struct {
+		FloatArr *quill.SnapshotReadPermission[[]float64]
+	}
+	type WriteView struct {
+		FloatArr []float64
+	}
+
+	data := &NastyData{FloatArr: []float64{1, 2, 3}}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	read := func(seen *[]float64) quill.Command {
+		return &quill.ViewCommand[SnapshotView]{
+			Action: func(view *SnapshotView) error {
+				*seen = view.FloatArr.Value()
+				return nil
+			},
+		}
+	}
+
+	// ACT ====================================================================
+	var unwritten []float64
+	assert.NoError(t, dataSource.Submit(read(&unwritten)).Wait())
+
+	var written []float64
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	reader := dataSource.Submit(&quill.ViewCommand[SnapshotView]{
+		Action: func(view *SnapshotView) error {
+			written = view.FloatArr.Value()
+			close(started)
+			<-finish
+			return nil
+		},
+	})
+	<-started
+	writer := dataSource.Submit(&quill.ViewCommand[WriteView]{
+		Action: func(view *WriteView) error {
+			view.FloatArr[0] = 10
+			return nil
+		},
+	})
+	writeErr := writer.Wait()
+	close(finish)
+
+	// ASSERT =================================================================
+	assert.NoError(t, writeErr)
+	assert.NoError(t, reader.Wait())
+	assert.NoError(t, dataSource.Close())
+
+	// Nothing wrote to the field while the first reader ran, so it was
+	// handed the field itself
+	assert.Same(t, &unwritten[0], &written[0])
+
+	// The writer was handed a copy instead of the field being read
+	assert.NotSame(t, &written[0], &data.FloatArr[0])
+	assert.Equal(t, []float64{1, 2, 3}, written)
+	assert.Equal(t, []float64{10, 2, 3}, data.FloatArr)
+}
+
+func TestSnapshotReadPermission_ConcurrentWriters(t *testing.T) {
+	// ARRANGE ================================================================
+	type SnapshotView struct {
+		FloatArr *quill.SnapshotReadPermission[[]float64]
+		Sub      *quill.SnapshotReadPermission[struct {
+			IntArr []int
+			Str    string
+		}]
+	}
+	type WriteView struct {
+		FloatArr []float64
+		Sub      struct {
+			IntArr []int
+		}
+	}
+
+	data := &NastyData{FloatArr: make([]float64, 100)}
+	data.Sub.IntArr = make([]int, 100)
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+	commands := make([]quill.Command, 0, 200)
+	for i := 0; i < 100; i++ {
+		value := i
+		commands = append(commands,
+			&quill.ViewCommand[SnapshotView]{
+				Action: func(view *SnapshotView) error {
+					// Every element was written by the same writer
+					floats, ints := view.FloatArr.Value(), view.Sub.Value().IntArr
+					for j := range floats {
+						if floats[j] != floats[0] || ints[j] != ints[0] {
+							return assert.AnError
+						}
+					}
+					return nil
+				},
+			},
+			&quill.ViewCommand[WriteView]{
+				Action: func(view *WriteView) error {
+					for j := range view.FloatArr {
+						view.FloatArr[j] = float64(value)
+						view.Sub.IntArr[j] = value
+					}
+					return nil
+				},
+			},
+		)
+	}
+
+	// ACT ====================================================================
+	futures := dataSource.Run(commands...)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, float64(99), data.FloatArr[0])
+	assert.Equal(t, 99, data.Sub.IntArr[99])
+}
+
+func TestSnapshotReadPermission_RejectsSharedData(t *testing.T) {
+	type Point struct {
+		X, Y float64
+	}
+	type hidden struct {
+		vals []float64
+	}
+	type SharedData struct {
+		Points  []*Point
+		Point   *Point
+		Values  []any
+		Lookup  map[string]*Point
+		Hidden  hidden
+		Pointed *struct{ Vals []float64 }
+	}
+
+	data := SharedData{Point: &Point{}, Pointed: &struct{ Vals []float64 }{}}
+	tests := map[string]any{
+		"slice of pointers": &struct {
+			Points *quill.SnapshotReadPermission[[]*Point]
+		}{},
+		"pointer": &struct {
+			Point *quill.SnapshotReadPermission[*Point]
+		}{},
+		"slice of interfaces": &struct {
+			Values *quill.SnapshotReadPermission[[]any]
+		}{},
+		"map of pointers": &struct {
+			Lookup *quill.SnapshotReadPermission[map[string]*Point]
+		}{},
+		"unexported slice": &struct {
+			Hidden *quill.SnapshotReadPermission[hidden]
+		}{},
+	}
+
+	for name, view := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ACT ============================================================
+			_, err := quill.PopulateView(data, view)
+
+			// ASSERT =========================================================
+			var viewErr quill.ViewError
+			assert.ErrorAs(t, err, &viewErr)
+		})
+	}
+
+	t.Run("data behind a field's pointer", func(t *testing.T) {
+		// ARRANGE ============================================================
+		view := &struct {
+			Pointed *quill.SnapshotReadPermission[struct{ Vals []float64 }]
+		}{}
+
+		// ACT ================================================================
+		_, err := quill.PopulateView(data, view)
+
+		// ASSERT =============================================================
+		assert.NoError(t, err)
+	})
+}
@@ -3,12 +3,45 @@ package quill
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
+// ViewError describes why a view can not be populated by a source.
+type ViewError struct {
+	// Path to the offending field within the view, separated by '.'
+	Path string
+
+	// Kind of the offending view field
+	ViewKind reflect.Kind
+
+	// Kind of the data within the source the view field maps to. Invalid if
+	// the source contains no such data.
+	SourceKind reflect.Kind
+
+	Reason string
+}
+
+func (ve ViewError) Error() string {
+	path := ve.Path
+	if path == "" {
+		path = "."
+	}
+	return fmt.Sprintf("view field '%s' (%s) can not be populated by source (%s): %s", path, ve.ViewKind, ve.SourceKind, ve.Reason)
+}
+
 type postQueryOperation interface {
 	apply()
 }
 
+// Change that runs code supplied by the command to work out what it stores,
+// which is ran for every change ahead of storing any of them, so that a panic
+// leaves the source untouched
+type preparedPostQueryOperation interface {
+	postQueryOperation
+	prepare()
+}
+
 type updateMapPostQueryOperation struct {
 	mapSource, mapKey, mapVal reflect.Value
 	field                     int
@@ -18,148 +51,63 @@ func (umqo updateMapPostQueryOperation) apply() {
 	umqo.mapSource.SetMapIndex(umqo.mapKey, umqo.mapVal.Field(umqo.field))
 }
 
-func getValueByName(val reflect.Value, name string) (reflect.Value, bool) {
-	t := val.Type()
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if name == f.Name {
-			return val.Field(i), true
-		}
-	}
-
-	return reflect.Value{}, false
+// Permission that writes the changes made during a command back to the
+// source once the command has finished
+type writeBackPermission interface {
+	postQueryOperation
+	written() bool
 }
 
-func populateViewStructsFromMap(source, view reflect.Value) []postQueryOperation {
-	viewType := view.Type()
-
-	sourceFieldKind := source.Kind()
-	if sourceFieldKind != reflect.Map {
-		panic(fmt.Errorf("source is not a map to process, is instead: '%s", sourceFieldKind.String()))
-	}
-
-	ops := make([]postQueryOperation, 0)
-
-	for i := 0; i < viewType.NumField(); i++ {
-		viewFieldValue := view.Field(i)
-		structField := viewType.Field(i)
-		if !viewFieldValue.CanSet() {
-			panic(fmt.Errorf("view contains the field (%s) that can not be assigned to. did you not pass a pointer?", structField.Name))
-		}
-
-		sourceName := structField.Name
-		if altName, ok := structField.Tag.Lookup("quill"); ok {
-			sourceName = altName
-		}
-		sourceField, mapHasKey := getMapValue(source, reflect.ValueOf(sourceName))
-		sourceFieldKind := sourceField.Kind()
-		viewFieldValueKind := viewFieldValue.Kind()
-
-		// View is requesting write access to an array from the source data
-		if viewFieldValueKind == reflect.Slice && sourceFieldKind == reflect.Slice {
-			viewFieldValue.Set(sourceField)
-			continue
-		}
-
-		if viewFieldValueKind == reflect.Slice && !mapHasKey {
-			newMapVal := reflect.New(viewFieldValue.Type()).Elem()
-			source.SetMapIndex(reflect.ValueOf(sourceName), newMapVal)
-			viewFieldValue.Set(newMapVal)
-			ops = append(ops, updateMapPostQueryOperation{
-				mapSource: source,
-				mapKey:    reflect.ValueOf(sourceName),
-				mapVal:    view,
-				field:     i,
-			})
-			continue
-		}
-
-		// View is requesting read only access
-		if viewFieldValueKind == reflect.Pointer {
-			newPtr := reflect.New(viewFieldValue.Type().Elem())
-			viewFieldValue.Set(newPtr)
-
-			i := viewFieldValue.Interface()
-			perm, ok := i.(Permission)
-			if !ok {
-				panic(fmt.Errorf("view field '%s' is an interface but not a permission which is not allowed", structField.Name))
-			}
+// Appends to a path in the source. Committed in the order the appenders were
+// granted the path when ran by a data source.
+type appendPostQueryOperation struct {
+	path string
+	perm appendPermission
+}
 
-			perm.inject(sourceField)
-			continue
-		}
+func (apqo appendPostQueryOperation) apply() {
+	apqo.perm.apply()
+}
 
-		if viewFieldValueKind == reflect.Struct && sourceFieldKind == reflect.Struct {
-			populateViewStructs(sourceField, viewFieldValue)
-			continue
-		}
+type setMapEntryPostQueryOperation struct {
+	mapSource, mapKey, entry reflect.Value
+	perm                     writeBackPermission
+}
 
-		panic(fmt.Errorf("unimplemented scenario where view's field '%s' is type %s and source is type %s", structField.Name, viewFieldValueKind.String(), sourceFieldKind.String()))
+func (smepqo setMapEntryPostQueryOperation) apply() {
+	if !smepqo.perm.written() {
+		return
 	}
-
-	return ops
+	smepqo.perm.apply()
+	smepqo.mapSource.SetMapIndex(smepqo.mapKey, smepqo.entry)
 }
 
-func populateViewStructs(source, view reflect.Value) []postQueryOperation {
-	viewType := view.Type()
-
-	ops := make([]postQueryOperation, 0)
-
-	for i := 0; i < viewType.NumField(); i++ {
-		viewFieldValue := view.Field(i)
-		structField := viewType.Field(i)
-		if !viewFieldValue.CanSet() {
-			panic(fmt.Errorf("view contains the field (%s) that can not be assigned to. did you not pass a pointer?", structField.Name))
-		}
-
-		sourceName := structField.Name
-		if altName, ok := structField.Tag.Lookup("quill"); ok {
-			sourceName = altName
-		}
-		sourceField, ok := getValueByName(source, sourceName)
-		if !ok {
-			panic(fmt.Errorf("source does not contain a field named: '%s' to populate view", sourceName))
-		}
-
-		sourceFieldKind := sourceField.Kind()
-		viewFieldValueKind := viewFieldValue.Kind()
-
-		// View is requesting write access to an array from the source data
-		if sourceFieldKind == reflect.Slice && viewFieldValueKind == reflect.Slice {
-			viewFieldValue.Set(sourceField)
-			continue
-		}
-
-		// View is requesting read only access
-		if viewFieldValueKind == reflect.Pointer {
-			newPtr := reflect.New(viewFieldValue.Type().Elem())
-			viewFieldValue.Set(newPtr)
-
-			i := viewFieldValue.Interface()
-			perm, ok := i.(Permission)
-			if !ok {
-				panic(fmt.Errorf("view field '%s' is an interface but not a permission which is not allowed", structField.Name))
+// Follows pointers until arriving at a value that is not a pointer
+func indirect(val reflect.Value, path string, viewKind reflect.Kind) (reflect.Value, error) {
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return val, ViewError{
+				Path:       path,
+				ViewKind:   viewKind,
+				SourceKind: reflect.Pointer,
+				Reason:     "source contains a nil pointer",
 			}
-
-			perm.inject(sourceField)
-			continue
-		}
-
-		if viewFieldValueKind == reflect.Struct && sourceFieldKind == reflect.Struct {
-			populateViewStructs(sourceField, viewFieldValue)
-			continue
 		}
+		val = val.Elem()
+	}
+	return val, nil
+}
 
-		if viewFieldValueKind == reflect.Struct && sourceFieldKind == reflect.Map {
-			mapOps := populateViewStructsFromMap(sourceField, viewFieldValue)
-			ops = append(ops, mapOps...)
-			continue
+func getValueByName(val reflect.Value, name string) (reflect.Value, bool) {
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name == f.Name {
+			return val.Field(i), true
 		}
-
-		panic(fmt.Errorf("unimplemented scenario where view's field '%s' is type %s and source is type %s", structField.Name, viewFieldValueKind.String(), sourceFieldKind.String()))
 	}
 
-	return ops
+	return reflect.Value{}, false
 }
 
 type ApplyChanges struct {
@@ -167,209 +115,116 @@ type ApplyChanges struct {
 }
 
 func (ac ApplyChanges) Apply() {
-	for _, c := range ac.changes {
-		c.apply()
-	}
+	ac.prepare()
+	ac.store()
 }
 
-func PopulateView(source, view any) ApplyChanges {
-	sourceValue := reflect.ValueOf(source)
-	sourceKind := sourceValue.Kind()
-	if sourceKind == reflect.Pointer {
-		panic("populating a view with a pointer to a source is not supported yet")
+// Works out what each change that runs code supplied by the command stores,
+// without storing anything
+func (ac ApplyChanges) prepare() {
+	for _, c := range ac.changes {
+		if prepared, ok := c.(preparedPostQueryOperation); ok {
+			prepared.prepare()
+		}
 	}
+}
 
-	if sourceKind != reflect.Struct {
-		panic(fmt.Errorf("views can not be populated by sources of type: %s", sourceKind.String()))
+// Stores every change in the source. Assumes the changes have been prepared.
+func (ac ApplyChanges) store() {
+	for _, c := range ac.changes {
+		c.apply()
 	}
+}
 
-	viewPointerValue := reflect.ValueOf(view)
-	viewPointerKind := viewPointerValue.Kind()
-	if viewPointerKind != reflect.Pointer {
-		panic("populating a view with a non-pointer to a source is not supported")
+// Populates the view with the source's data. Changes made through
+// permissions that write back to the source are only visible in the source
+// if a pointer to the source is provided, otherwise they're applied to a
+// copy of it.
+func PopulateView(source, view any) (ApplyChanges, error) {
+	sourceValue := reflect.ValueOf(source)
+	if sourceValue.IsValid() && sourceValue.Kind() != reflect.Pointer {
+		addressable := reflect.New(sourceValue.Type()).Elem()
+		addressable.Set(sourceValue)
+		sourceValue = addressable
 	}
+	return populateView(sourceValue, view)
+}
 
-	viewValue := viewPointerValue.Elem()
-	viewKind := viewValue.Kind()
-	if viewKind != reflect.Struct {
-		panic(fmt.Errorf("views of type: '%s' can not be populated", viewKind.String()))
+// Populates the view with the source's data. The source must be addressable
+// for any permission that writes back to the source to apply its changes.
+func populateView(sourceValue reflect.Value, view any) (ApplyChanges, error) {
+	viewType := reflect.TypeOf(view)
+	if !sourceValue.IsValid() || viewType == nil {
+		return ApplyChanges{}, ViewError{Reason: "views and sources must be structs"}
 	}
 
-	return ApplyChanges{
-		changes: populateViewStructs(sourceValue, viewValue),
+	plan, err := compileViewPlan(sourceValue.Type(), viewType)
+	if err != nil {
+		return ApplyChanges{}, err
 	}
+	return plan.populate(sourceValue, view)
 }
 
 func getMapValue(mapSource, key reflect.Value) (reflect.Value, bool) {
-	iter := mapSource.MapRange()
-	for iter.Next() {
-		k := iter.Key()
-		v := iter.Value()
-		if k.Interface() == key.Interface() {
-			return v, true
-		}
-	}
-	return reflect.ValueOf(nil), false
+	v := mapSource.MapIndex(key)
+	return v, v.IsValid()
 }
 
-func permissionsStructFromMap(path string, source, view reflect.Value) map[string]PermissionType {
-	permissions := make(map[string]PermissionType)
-	viewType := view.Type()
-
-	if source.Kind() != reflect.Map {
-		panic(fmt.Errorf("source is not a map to process, is instead: '%s", source.Kind().String()))
-	}
-
-	for i := 0; i < viewType.NumField(); i++ {
-		viewFieldValue := view.Field(i)
-		structField := viewType.Field(i)
-		if !viewFieldValue.CanSet() {
-			panic(fmt.Errorf("view contains the field (%s) that can not be assigned to. did you not pass a pointer?", structField.Name))
-		}
-
-		mapKeyName := structField.Name
-		if altName, ok := structField.Tag.Lookup("quill"); ok {
-			mapKeyName = altName
-		}
-
-		sourceField, sourceContainsKey := getMapValue(source, reflect.ValueOf(mapKeyName))
-		sourceFieldKind := sourceField.Kind()
-		viewFieldValueKind := viewFieldValue.Kind()
-
-		// View is requesting write access to an array from the map source data
-		if viewFieldValueKind == reflect.Slice && (!sourceContainsKey || sourceFieldKind == reflect.Slice) {
-			permissions[fmt.Sprintf("%s.%s", path, structField.Name)] = WritePermissionType
-			continue
-		}
-
-		// View is requesting read only access for a specific data type
-		if viewFieldValueKind == reflect.Pointer {
-			newPtr := reflect.New(viewFieldValue.Type().Elem())
-			viewFieldValue.Set(newPtr)
-
-			i := viewFieldValue.Interface()
-			perm, ok := i.(Permission)
-			if !ok {
-				panic(fmt.Errorf("view field '%s' is an interface but not a permission which is not allowed", structField.Name))
-			}
-
-			permissions[fmt.Sprintf("%s.%s", path, structField.Name)] = perm.Type()
-			continue
-		}
-
-		if viewFieldValueKind == reflect.Struct && sourceFieldKind == reflect.Struct {
-			subPermissions := permissionsStruct(fmt.Sprintf("%s.%s", path, structField.Name), sourceField, viewFieldValue)
-			for key, val := range subPermissions {
-				permissions[key] = val
-			}
-
-			continue
-		}
-
-		// We want specific read/write access to a source's map
-		if viewFieldValueKind == reflect.Struct && sourceFieldKind == reflect.Map {
-			subPermissions := permissionsStructFromMap(fmt.Sprintf("%s.%s", path, structField.Name), sourceField, viewFieldValue)
-			for key, val := range subPermissions {
-				permissions[key] = val
-			}
-
-			continue
-		}
+// Escapes the characters of a key that would otherwise be read as the
+// separator between segments or the start of a range
+var mapKeyEscaper = strings.NewReplacer("%", "%25", ".", "%2E", "[", "%5B")
 
-		panic(fmt.Errorf("unimplemented scenario where view's field '%s' is type %s and source is type %s", structField.Name, viewFieldValueKind.String(), sourceFieldKind.String()))
-	}
-	return permissions
+// Segment of a permission path referring to the entry of a map with the key
+func mapKeySegment(key any) string {
+	return mapKeyEscaper.Replace(fmt.Sprint(key))
 }
 
-func permissionsStruct(path string, source, view reflect.Value) map[string]PermissionType {
-	permissions := make(map[string]PermissionType)
-	viewType := view.Type()
-	for i := 0; i < viewType.NumField(); i++ {
-		viewFieldValue := view.Field(i)
-		structField := viewType.Field(i)
-		if !viewFieldValue.CanSet() {
-			panic(fmt.Errorf("view contains the field (%s) that can not be assigned to. did you not pass a pointer?", structField.Name))
-		}
+// Interprets the name of a view's field as a key of the map type provided,
+// allowing views to address maps keyed by anything we can parse from a
+// string, such as `quill:"5"` on a map[int]...
+func mapKeyFromName(name string, keyType reflect.Type) (reflect.Value, error) {
+	key := reflect.New(keyType).Elem()
+	switch keyType.Kind() {
+	case reflect.String:
+		key.SetString(name)
 
-		sourceName := structField.Name
-		if altName, ok := structField.Tag.Lookup("quill"); ok {
-			sourceName = altName
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(name, 10, keyType.Bits())
+		if err != nil {
+			return key, err
 		}
-		sourceField, ok := getValueByName(source, sourceName)
-		if !ok {
-			panic(fmt.Errorf("source does not contain a field named: '%s' to populate view", sourceName))
-		}
-
-		sourceFieldKind := sourceField.Kind()
-		viewFieldValueKind := viewFieldValue.Kind()
+		key.SetInt(i)
 
-		// View is requesting write access to an array from the source data
-		if sourceFieldKind == reflect.Slice && viewFieldValueKind == reflect.Slice {
-			permissions[fmt.Sprintf("%s.%s", path, structField.Name)] = WritePermissionType
-			continue
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(name, 10, keyType.Bits())
+		if err != nil {
+			return key, err
 		}
+		key.SetUint(u)
 
-		// View is requesting read only access for a specific data type
-		if viewFieldValueKind == reflect.Pointer {
-			newPtr := reflect.New(viewFieldValue.Type().Elem())
-			viewFieldValue.Set(newPtr)
-
-			i := viewFieldValue.Interface()
-			perm, ok := i.(Permission)
-			if !ok {
-				panic(fmt.Errorf("view field '%s' is an interface but not a permission which is not allowed", structField.Name))
-			}
-
-			permissions[fmt.Sprintf("%s.%s", path, structField.Name)] = perm.Type()
-			continue
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(name, keyType.Bits())
+		if err != nil {
+			return key, err
 		}
+		key.SetFloat(f)
 
-		if viewFieldValueKind == reflect.Struct && sourceFieldKind == reflect.Struct {
-			subPermissions := permissionsStruct(fmt.Sprintf("%s.%s", path, structField.Name), sourceField, viewFieldValue)
-			for key, val := range subPermissions {
-				permissions[key] = val
-			}
-
-			continue
+	case reflect.Bool:
+		b, err := strconv.ParseBool(name)
+		if err != nil {
+			return key, err
 		}
+		key.SetBool(b)
 
-		// We want specific read/write access to a source's map
-		if viewFieldValueKind == reflect.Struct && sourceFieldKind == reflect.Map {
-			subPermissions := permissionsStructFromMap(fmt.Sprintf("%s.%s", path, structField.Name), sourceField, viewFieldValue)
-			for key, val := range subPermissions {
-				permissions[key] = val
-			}
-
-			continue
+	case reflect.Interface:
+		nameValue := reflect.ValueOf(name)
+		if !nameValue.Type().AssignableTo(keyType) {
+			return key, fmt.Errorf("string keys can not be assigned to %s", keyType)
 		}
+		key.Set(nameValue)
 
-		panic(fmt.Errorf("unimplemented scenario where view's field '%s' is type %s and source is type %s", structField.Name, viewFieldValueKind.String(), sourceFieldKind.String()))
-	}
-	return permissions
-}
-
-func calculatePermissions(source, view any) map[string]PermissionType {
-	sourceValue := reflect.ValueOf(source)
-	sourceKind := sourceValue.Kind()
-	if sourceKind == reflect.Pointer {
-		panic("populating a view with a pointer to a source is not supported yet")
+	default:
+		return key, fmt.Errorf("can not build a map key of type %s from a name", keyType)
 	}
-
-	if sourceKind != reflect.Struct {
-		panic(fmt.Errorf("views can not be populated by sources of type: %s", sourceKind.String()))
-	}
-
-	viewPointerValue := reflect.ValueOf(view)
-	viewPointerKind := viewPointerValue.Kind()
-	if viewPointerKind != reflect.Pointer {
-		panic("populating a view with a non-pointer to a source is not supported")
-	}
-
-	viewValue := viewPointerValue.Elem()
-	viewKind := viewValue.Kind()
-	if viewKind != reflect.Struct {
-		panic(fmt.Errorf("views of type: '%s' can not be populated", viewKind.String()))
-	}
-
-	return permissionsStruct("", sourceValue, viewValue)
+	return key, nil
 }
@@ -0,0 +1,721 @@
+package quill
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+type dataSourceWorkerJob struct {
+	ctx         context.Context
+	command     Command
+	index       int
+	commandData any
+	plan        *viewPlan
+	permissions map[string]PermissionType
+	future      *Future
+
+	// Closed once the job has left the scheduler's pending window
+	scheduled chan struct{}
+
+	// Job this job is a chunk of, if it was split into chunks
+	split *splitJob
+
+	// Places in line for committing appends, by the path appended to
+	appendEntries map[string]*appendEntry
+
+	// Futures of the commands the job was explicitly ordered after
+	after []*Future
+
+	// Jobs with a higher priority are admitted ahead of those with a lower
+	// one
+	priority int
+
+	// When and in what order the scheduler received the job
+	received time.Time
+	sequence int
+
+	// Commands ran by the job as a single transaction, if the job is one
+	transaction *transaction
+
+	// Snapshots the job's command is reading from
+	snapshots []heldSnapshot
+}
+
+// Priority of the job after accounting for how long it has been waiting, so
+// low priority jobs eventually get their turn
+func (job *dataSourceWorkerJob) effectivePriority(now time.Time, aging time.Duration) int {
+	if aging <= 0 {
+		return job.priority
+	}
+	return job.priority + int(now.Sub(job.received)/aging)
+}
+
+// Whether or not every command the job was ordered after has finished
+func (job *dataSourceWorkerJob) dependenciesFinished() bool {
+	for _, dependency := range job.after {
+		select {
+		case <-dependency.Done():
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Whether or not any command the job was ordered after didn't succeed
+func (job *dataSourceWorkerJob) dependencyFailed() bool {
+	for _, dependency := range job.after {
+		if dependency.Err() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Marks the job as finished, reporting the error if one occurred.
+func (job *dataSourceWorkerJob) finish(wg *sync.WaitGroup, errs *commandErrors, err error) {
+	if job.split != nil {
+		job.split.finishChunk(wg, errs, err)
+		return
+	}
+
+	if err != nil {
+		// Transactions attribute failures to the command that caused them
+		var commandErr CommandError
+		if job.transaction == nil || !errors.As(err, &commandErr) {
+			err = newCommandError(job.index, job.command, err)
+		}
+		if !errors.Is(err, ErrCommandSkipped) {
+			errs.report(err)
+		}
+	}
+	job.future.complete(err)
+	wg.Done()
+}
+
+// Job split into chunks that run in parallel, which finishes once every
+// chunk has finished
+type splitJob struct {
+	job       *dataSourceWorkerJob
+	lock      sync.Mutex
+	remaining int
+	errs      []error
+}
+
+func (sj *splitJob) finishChunk(wg *sync.WaitGroup, errs *commandErrors, err error) {
+	sj.lock.Lock()
+	if err != nil {
+		sj.errs = append(sj.errs, err)
+	}
+	sj.remaining--
+	last := sj.remaining == 0
+	sj.lock.Unlock()
+
+	if !last {
+		return
+	}
+
+	// The job was only skipped if every chunk that didn't succeed was
+	// skipped, otherwise report whatever actually went wrong
+	failures := make([]error, 0, len(sj.errs))
+	for _, chunkErr := range sj.errs {
+		if !errors.Is(chunkErr, ErrCommandSkipped) {
+			failures = append(failures, chunkErr)
+		}
+	}
+	if len(failures) == 0 && len(sj.errs) > 0 {
+		failures = append(failures, ErrCommandSkipped)
+	}
+	sj.job.finish(wg, errs, errors.Join(failures...))
+}
+
+type scheduler struct {
+	data            reflect.Value
+	plans           *viewPlanCache
+	permissionTable *PermissionTable
+	wg              *sync.WaitGroup
+	errs            *commandErrors
+	window          int
+	workers         int
+	aging           time.Duration
+
+	jobs chan *dataSourceWorkerJob
+
+	// Go maps can't be read while they're written to, even when different
+	// keys are involved. Commands populating views from maps hold the read
+	// lock, while changes are stored back in the source under the write lock.
+	// Holding the write lock while applying changes also keeps accumulators
+	// sharing a field from merging into it at the same time.
+	maps sync.RWMutex
+
+	appends   *appendLog
+	snapshots *snapshotCache
+
+	// Poked whenever something outside of the permission table happens that
+	// might let a pending job leave the window
+	wake chan struct{}
+
+	// Jobs received that have yet to be handed off to a worker, ordered by
+	// their effective priority and then by the order they were submitted
+	pending []*dataSourceWorkerJob
+
+	// Whether or not the order of the pending jobs can change as they age
+	reordering bool
+
+	// Number of jobs received so far
+	received int
+
+	// Jobs received that are still waiting on the commands they were ordered
+	// after. They only join the pending window once those commands have
+	// finished, so they never hold up the commands they're waiting on.
+	waiting []*dataSourceWorkerJob
+}
+
+func newScheduler(data reflect.Value, plans *viewPlanCache, wg *sync.WaitGroup, errs *commandErrors, config dataSourceConfig) *scheduler {
+	window := config.window
+	if window < 1 {
+		window = 1
+	}
+
+	s := &scheduler{
+		data:            data,
+		plans:           plans,
+		permissionTable: NewPermissionTableWithFairness(config.fairness),
+		wg:              wg,
+		errs:            errs,
+		window:          window,
+		aging:           config.priorityAging,
+		jobs:            make(chan *dataSourceWorkerJob, 1000),
+		appends:         newAppendLog(),
+		snapshots:       newSnapshotCache(),
+		wake:            make(chan struct{}, 1),
+		pending:         make([]*dataSourceWorkerJob, 0, window),
+	}
+
+	numWorkers := config.poolSize
+	if numWorkers > 1 {
+		numWorkers -= 1 // Leave one cpu unallocated for the scheduler goroutine
+	}
+	// numWorkers = 2
+
+	s.workers = numWorkers
+
+	for i := 0; i < numWorkers; i++ {
+		go s.worker(i)
+	}
+
+	return s
+}
+
+func (s *scheduler) worker(index int) {
+	// ctx, task := trace.NewTask(context.Background(), fmt.Sprintf("datasourceWorker-%d", index))
+	for job := range s.jobs {
+		if s.errs.stopped() {
+			s.release(job, nil)
+			job.finish(s.wg, s.errs, ErrCommandSkipped)
+			continue
+		}
+
+		// Command was cancelled before it ever got the chance to start
+		if err := job.ctx.Err(); err != nil {
+			s.release(job, nil)
+			job.finish(s.wg, s.errs, err)
+			continue
+		}
+
+		if job.transaction != nil {
+			err := s.runTransaction(job)
+			s.release(job, nil)
+			job.finish(s.wg, s.errs, err)
+			continue
+		}
+
+		// Chunks of a split job are populated ahead of time by the scheduler
+		applyChanges := ApplyChanges{}
+		if job.split == nil {
+			var err error
+			applyChanges, err = s.populate(job)
+			if err != nil {
+				s.release(job, nil)
+				job.finish(s.wg, s.errs, err)
+				continue
+			}
+			s.takeSnapshots(job)
+		}
+
+		// trace.WithRegion(ctx, "command", func() { job.command.Run() })
+		err := runRecovered(job.ctx, job.command)
+
+		// Whatever a command left behind when it panicked can't be trusted
+		var panicErr PanicError
+		if errors.As(err, &panicErr) {
+			s.release(job, nil)
+			job.finish(s.wg, s.errs, err)
+			continue
+		}
+
+		appends, applyErr := s.apply(applyChanges)
+		if applyErr != nil {
+			err = applyErr
+		}
+		s.release(job, appends)
+		job.finish(s.wg, s.errs, err)
+	}
+	// task.End()
+}
+
+func (s *scheduler) populate(job *dataSourceWorkerJob) (ApplyChanges, error) {
+	if job.plan.readsMaps {
+		s.maps.RLock()
+		defer s.maps.RUnlock()
+	}
+	return job.plan.populate(s.data, job.commandData)
+}
+
+// Stores the changes made by a job back in the source, except for appends,
+// which are returned by the path they append to so they can be committed in
+// order. Nothing is stored if preparing the changes panics.
+func (s *scheduler) apply(applyChanges ApplyChanges) (map[string]func(), error) {
+	if len(applyChanges.changes) == 0 {
+		return nil, nil
+	}
+
+	var appends map[string]func()
+	s.maps.Lock()
+	defer s.maps.Unlock()
+	if err := prepareRecovered(applyChanges); err != nil {
+		return nil, err
+	}
+	for _, change := range applyChanges.changes {
+		if appendChange, ok := change.(appendPostQueryOperation); ok {
+			if appends == nil {
+				appends = make(map[string]func())
+			}
+			appends[appendChange.path] = appendChange.perm.detach()
+			continue
+		}
+		change.apply()
+	}
+	return appends, nil
+}
+
+// Gives up everything the job was granted, committing its appends in the
+// order the appenders were granted each path.
+func (s *scheduler) release(job *dataSourceWorkerJob, appends map[string]func()) {
+	for path, entry := range job.appendEntries {
+		s.appends.resolve(path, entry, appends[path])
+	}
+	for _, held := range job.snapshots {
+		s.snapshots.release(held.path, held.snapshot)
+	}
+	job.snapshots = nil
+	s.permissionTable.Clear(job.permissions)
+}
+
+// Hands the writer about to be granted the permissions a copy of every field
+// still being read as a snapshot, leaving the snapshot's readers as the only
+// ones with the original.
+func (s *scheduler) copySnapshots(permissions map[string]PermissionType) {
+	locations := s.snapshots.detach(permissions)
+	if len(locations) == 0 {
+		return
+	}
+
+	// Fields within maps are copied back into their entries
+	s.maps.Lock()
+	defer s.maps.Unlock()
+	for _, location := range locations {
+		copyInPlace(s.data, location)
+	}
+}
+
+// Records the data the job's snapshot permissions were populated with as
+// being read as a snapshot, then gives up the job's access to that data so
+// writers don't have to wait on the job.
+func (s *scheduler) takeSnapshots(job *dataSourceWorkerJob) {
+	if len(job.plan.snapshots) == 0 {
+		return
+	}
+
+	view := reflect.ValueOf(job.commandData).Elem()
+	released := make(map[string]PermissionType, len(job.plan.snapshots))
+	for _, sf := range job.plan.snapshots {
+		perm := view.FieldByIndex(sf.viewIndices).Interface().(snapshotPermission)
+		entry := s.snapshots.take(sf.permissionPath, sf.location)
+		perm.useSnapshot(entry.version)
+		job.snapshots = append(job.snapshots, heldSnapshot{path: sf.permissionPath, snapshot: entry})
+		released[sf.permissionPath] = ReadPermissionType
+	}
+
+	// The job's permissions may be shared with its plan, so are copied
+	// rather than modified
+	remaining := make(map[string]PermissionType, len(job.permissions))
+	for path, perm := range job.permissions {
+		if _, ok := released[path]; !ok {
+			remaining[path] = perm
+		}
+	}
+	s.permissionTable.Clear(released)
+	job.permissions = remaining
+}
+
+func (s *scheduler) run(commands <-chan *dataSourceWorkerJob) {
+	for commands != nil || len(s.pending) > 0 || len(s.waiting) > 0 {
+		// Grab the version before attempting to admit anything so we don't
+		// miss a clear that happens in between
+		version := s.permissionTable.Version()
+		s.admitWaiting()
+		s.prioritize()
+		s.admitPending()
+
+		var incoming <-chan *dataSourceWorkerJob
+		if len(s.pending)+len(s.waiting) < s.window {
+			incoming = commands
+		}
+
+		// Check back in once jobs have aged, as a job overtaking another
+		// might be able to start
+		var aged <-chan time.Time
+		if s.reordering && len(s.pending) > 0 {
+			aged = time.After(s.aging)
+		}
+
+		select {
+		case job, ok := <-incoming:
+			if !ok {
+				commands = nil
+				continue
+			}
+			s.enqueue(job)
+
+		case <-s.permissionTable.changedSince(version):
+		case <-s.wake:
+		case <-aged:
+		}
+	}
+	close(s.jobs)
+}
+
+func (s *scheduler) enqueue(job *dataSourceWorkerJob) {
+	job.received = time.Now()
+	job.sequence = s.received
+	s.received++
+
+	if job.transaction != nil {
+		if err := s.planTransaction(job); err != nil {
+			s.drop(job, err)
+			return
+		}
+	} else {
+		job.commandData = job.command.data()
+		plan, err := s.plans.get(s.data.Type(), reflect.TypeOf(job.commandData))
+		if err != nil {
+			// Invalid views are rejected before they ever get the chance to
+			// be scheduled
+			s.drop(job, err)
+			return
+		}
+		job.plan = plan
+		job.permissions, err = plan.permissionsFor(job.commandData)
+		if err != nil {
+			s.drop(job, err)
+			return
+		}
+	}
+
+	if len(job.after) > 0 {
+		s.waiting = append(s.waiting, job)
+
+		// Wake the scheduler up once every command the job is waiting on has
+		// finished
+		go func() {
+			for _, dependency := range job.after {
+				select {
+				case <-dependency.Done():
+				case <-job.scheduled:
+					return
+				}
+			}
+			select {
+			case s.wake <- struct{}{}:
+			default:
+			}
+		}()
+	} else {
+		s.pending = append(s.pending, job)
+	}
+
+	// Wake the scheduler up if the job is cancelled while still pending so it
+	// can be removed from the window
+	if done := job.ctx.Done(); done != nil {
+		go func() {
+			select {
+			case <-done:
+				select {
+				case s.wake <- struct{}{}:
+				default:
+				}
+			case <-job.scheduled:
+			}
+		}()
+	}
+}
+
+// Works out the permissions required by every command within the
+// transaction, which the transaction holds for its entire duration
+func (s *scheduler) planTransaction(job *dataSourceWorkerJob) error {
+	sets := make([]map[string]PermissionType, len(job.transaction.members))
+	locations := make(map[string][]pathStep)
+	for i, member := range job.transaction.members {
+		member.commandData = member.command.data()
+		plan, err := s.plans.get(s.data.Type(), reflect.TypeOf(member.commandData))
+		if err != nil {
+			return newCommandError(member.index, member.command, err)
+		}
+		member.plan = plan
+		if sets[i], err = plan.permissionsFor(member.commandData); err != nil {
+			return newCommandError(member.index, member.command, err)
+		}
+		for path, location := range plan.locationsFor(member.commandData) {
+			locations[path] = location
+		}
+	}
+	job.permissions = transactionPermissions(sets, locations)
+	job.transaction.locations = locations
+	return nil
+}
+
+// Runs every command of the transaction one after another against a private
+// copy of the data the transaction holds, only storing the changes made in
+// the source if every command succeeds.
+func (s *scheduler) runTransaction(job *dataSourceWorkerJob) error {
+	s.maps.RLock()
+	shadow := buildShadow(s.data, job.permissions, job.transaction.locations)
+	s.maps.RUnlock()
+
+	for _, member := range job.transaction.members {
+		applyChanges, err := member.plan.populate(shadow, member.commandData)
+		if err != nil {
+			return newCommandError(member.index, member.command, err)
+		}
+		if err := runRecovered(job.ctx, member.command); err != nil {
+			return newCommandError(member.index, member.command, err)
+		}
+
+		// Later commands see the changes of earlier ones
+		if err := prepareRecovered(applyChanges); err != nil {
+			return newCommandError(member.index, member.command, err)
+		}
+		applyChanges.store()
+	}
+
+	s.maps.Lock()
+	defer s.maps.Unlock()
+	for path, perm := range job.permissions {
+		if perm != WritePermissionType {
+			continue
+		}
+		commitPath(s.data, shadow, job.transaction.locations[path])
+	}
+	return nil
+}
+
+// Finishes a job that never made it to a worker
+func (s *scheduler) drop(job *dataSourceWorkerJob, err error) {
+	close(job.scheduled)
+	job.finish(s.wg, s.errs, err)
+}
+
+// Moves every waiting job whose dependencies have all finished into the
+// pending window, skipping jobs whose dependencies didn't succeed.
+func (s *scheduler) admitWaiting() {
+	remaining := s.waiting[:0]
+	for _, job := range s.waiting {
+		if err := job.ctx.Err(); err != nil {
+			s.drop(job, err)
+			continue
+		}
+
+		if !job.dependenciesFinished() {
+			remaining = append(remaining, job)
+			continue
+		}
+
+		if job.dependencyFailed() {
+			s.drop(job, ErrCommandSkipped)
+			continue
+		}
+		s.pending = append(s.pending, job)
+	}
+
+	for i := len(remaining); i < len(s.waiting); i++ {
+		s.waiting[i] = nil
+	}
+	s.waiting = remaining
+}
+
+// Orders the pending window by effective priority, keeping jobs of the same
+// effective priority in the order they were submitted.
+func (s *scheduler) prioritize() {
+	// Jobs sharing a priority never overtake one another, as the job
+	// received first has always aged at least as much
+	s.reordering = false
+	for _, job := range s.pending {
+		if job.priority != s.pending[0].priority {
+			s.reordering = s.aging > 0
+			break
+		}
+	}
+
+	now := time.Now()
+	sort.Slice(s.pending, func(i, j int) bool {
+		a, b := s.pending[i], s.pending[j]
+		pa, pb := a.effectivePriority(now, s.aging), b.effectivePriority(now, s.aging)
+		if pa != pb {
+			return pa > pb
+		}
+		return a.sequence < b.sequence
+	})
+}
+
+// Hands off every pending job to the workers that can currently run. A job
+// can only start once it no longer conflicts with any running job, nor with
+// the pending jobs the fairness policy requires it to wait on. Writers to a
+// field still being read as a snapshot also wait until the field can be
+// copied.
+func (s *scheduler) admitPending() {
+	remaining := s.pending[:0]
+	for i, job := range s.pending {
+		if s.errs.stopped() {
+			s.drop(job, ErrCommandSkipped)
+			continue
+		}
+
+		if err := job.ctx.Err(); err != nil {
+			s.drop(job, err)
+			continue
+		}
+
+		writes := permissionsWrite(job.permissions)
+		if s.blockedByPending(job, remaining, s.pending[i+1:]) ||
+			(writes && s.snapshots.blocks(job.permissions, s.permissionTable)) ||
+			!s.permissionTable.TryAdd(job.permissions) {
+			remaining = append(remaining, job)
+			continue
+		}
+
+		close(job.scheduled)
+		if writes {
+			s.copySnapshots(job.permissions)
+		}
+		s.registerAppends(job)
+		if command, ok := job.command.(chunkedCommand); ok && job.transaction == nil && s.workers > 1 {
+			s.split(job, command)
+			continue
+		}
+		s.jobs <- job
+	}
+
+	// Release references to jobs no longer pending
+	for i := len(remaining); i < len(s.pending); i++ {
+		s.pending[i] = nil
+	}
+	s.pending = remaining
+}
+
+// Reserves the job's place in line for committing appends to every path it
+// was granted append access to
+func (s *scheduler) registerAppends(job *dataSourceWorkerJob) {
+	for path, perm := range job.permissions {
+		if perm != AppendPermissionType {
+			continue
+		}
+		if job.appendEntries == nil {
+			job.appendEntries = make(map[string]*appendEntry)
+		}
+		job.appendEntries[path] = s.appends.register(path)
+	}
+}
+
+// Splits a job that has been granted write access to an entire slice into
+// chunks that each only hold their range of the slice, handing the chunks off
+// to the workers to run in parallel.
+func (s *scheduler) split(job *dataSourceWorkerJob, command chunkedCommand) {
+	// We hold the entire slice at this point, so its length can't change out
+	// from underneath us
+	applyChanges, err := s.populate(job)
+	if err != nil {
+		s.release(job, nil)
+		job.finish(s.wg, s.errs, err)
+		return
+	}
+
+	// Chunked commands only ever read or write the slice, so have nothing to
+	// append
+	s.apply(applyChanges)
+
+	length := command.length()
+	chunks := s.workers
+	if length < chunks {
+		chunks = length
+	}
+	if chunks <= 1 {
+		s.jobs <- job
+		return
+	}
+
+	// Chunks hold the same kind of access to their range as the job held to
+	// the entire slice
+	path, permission := "", WritePermissionType
+	for key, perm := range job.permissions {
+		path, permission = key, perm
+	}
+
+	ranges := make([]sliceRange, chunks)
+	chunkPermissions := make([]map[string]PermissionType, chunks)
+	for i := range ranges {
+		ranges[i] = sliceRange{start: i * length / chunks, end: (i + 1) * length / chunks}
+		chunkPermissions[i] = map[string]PermissionType{
+			path + "." + ranges[i].segment(): permission,
+		}
+	}
+
+	split := &splitJob{job: job, remaining: chunks}
+	chunkJobs := make([]*dataSourceWorkerJob, chunks)
+	for i, chunk := range command.split(ranges) {
+		chunkJobs[i] = &dataSourceWorkerJob{
+			ctx:         job.ctx,
+			command:     chunk,
+			index:       job.index,
+			permissions: chunkPermissions[i],
+			split:       split,
+		}
+	}
+
+	s.permissionTable.exchange(job.permissions, chunkPermissions)
+	for _, chunkJob := range chunkJobs {
+		s.jobs <- chunkJob
+	}
+}
+
+// Whether or not the job has to keep waiting on other pending jobs, given
+// the jobs still pending that were submitted ahead of and behind it. Pending
+// jobs queue behind one another the same way callers of AddBlocking do.
+func (s *scheduler) blockedByPending(job *dataSourceWorkerJob, ahead, behind []*dataSourceWorkerJob) bool {
+	fairness := s.permissionTable.fairness
+	for _, other := range ahead {
+		if fairness.queuesBehind(job.permissions, other.permissions, true) {
+			return true
+		}
+	}
+	for _, other := range behind {
+		if fairness.queuesBehind(job.permissions, other.permissions, false) {
+			return true
+		}
+	}
+	return false
+}
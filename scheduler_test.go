@@ -0,0 +1,287 @@
+package quill_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_NonConflictingCommandsSkipBlockedCommands(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	type ReadFloatArrView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	type ReadStrArrView struct {
+		StrArr *quill.ArrayReadPermission[string]
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+		StrArr:   []string{"a", "b", "c"},
+	}, quill.WithPoolSize(4))
+	release := make(chan struct{})
+	read := 0.
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[WriteFloatArrView]{
+			Action: func(view *WriteFloatArrView) error {
+				<-release
+				view.FloatArr[0] = 10
+				return nil
+			},
+		},
+		&quill.ViewCommand[WriteFloatArrView]{
+			Action: func(view *WriteFloatArrView) error {
+				view.FloatArr[0] *= 2
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadFloatArrView]{
+			Action: func(view *ReadFloatArrView) error {
+				read = view.FloatArr.Value().At(0)
+				return nil
+			},
+		},
+	)
+	unrelated := dataSource.Submit(&quill.ViewCommand[ReadStrArrView]{
+		Action: func(view *ReadStrArrView) error {
+			return nil
+		},
+	})
+
+	unrelatedErr := unrelated.Wait()
+	close(release)
+
+	// ASSERT =================================================================
+	assert.NoError(t, unrelatedErr)
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.Equal(t, 20., read)
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestScheduler_WindowOfOne(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	type WriteStrArrView struct {
+		StrArr []string
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		FloatArr: []float64{1, 2, 3},
+		StrArr:   []string{"a", "b", "c"},
+	}, quill.WithPoolSize(4), quill.WithSchedulingWindow(1))
+	release := make(chan struct{})
+	blocking := func(view *WriteFloatArrView) error {
+		<-release
+		return nil
+	}
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[WriteFloatArrView]{Action: blocking},
+		&quill.ViewCommand[WriteFloatArrView]{Action: blocking},
+	)
+	unrelated := dataSource.Submit(&quill.ViewCommand[WriteStrArrView]{
+		Action: func(view *WriteStrArrView) error {
+			return nil
+		},
+	})
+
+	ranWhileBlocked := false
+	select {
+	case <-unrelated.Done():
+		ranWhileBlocked = true
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+
+	// ASSERT =================================================================
+	assert.False(t, ranWhileBlocked)
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, unrelated.Wait())
+	assert.NoError(t, dataSource.Close())
+}
+
+func TestScheduler_Fairness(t *testing.T) {
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	type ReadFloatArrView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	tests := map[string]struct {
+		policy       quill.FairnessPolicy
+		holderWrites bool
+		writerFirst  bool
+		order        []string
+	}{
+		"fifo: reader waits on writer submitted before it": {
+			policy:      quill.FIFOFair,
+			writerFirst: true,
+			order:       []string{"write", "read"},
+		},
+		"reader preferred: reader passes waiting writer": {
+			policy:      quill.ReaderPreferred,
+			writerFirst: true,
+			order:       []string{"read", "write"},
+		},
+		"writer preferred: reader waits on writer submitted before it": {
+			policy:      quill.WriterPreferred,
+			writerFirst: true,
+			order:       []string{"write", "read"},
+		},
+		"fifo: writer waits on reader submitted before it": {
+			policy:       quill.FIFOFair,
+			holderWrites: true,
+			order:        []string{"read", "write"},
+		},
+		"reader preferred: writer waits on reader submitted before it": {
+			policy:       quill.ReaderPreferred,
+			holderWrites: true,
+			order:        []string{"read", "write"},
+		},
+		"writer preferred: writer passes waiting reader": {
+			policy:       quill.WriterPreferred,
+			holderWrites: true,
+			order:        []string{"write", "read"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			dataSource := quill.NewDataSource(NastyData{
+				FloatArr: []float64{1, 2, 3},
+			}, quill.WithPoolSize(4), quill.WithFairness(tc.policy))
+
+			release := make(chan struct{})
+			orderLock := sync.Mutex{}
+			order := make([]string, 0)
+			record := func(entry string) {
+				orderLock.Lock()
+				defer orderLock.Unlock()
+				order = append(order, entry)
+			}
+
+			var holder quill.Command = &quill.ViewCommand[ReadFloatArrView]{
+				Action: func(view *ReadFloatArrView) error {
+					<-release
+					return nil
+				},
+			}
+			if tc.holderWrites {
+				holder = &quill.ViewCommand[WriteFloatArrView]{
+					Action: func(view *WriteFloatArrView) error {
+						<-release
+						return nil
+					},
+				}
+			}
+
+			writer := &quill.ViewCommand[WriteFloatArrView]{
+				Action: func(view *WriteFloatArrView) error {
+					record("write")
+					return nil
+				},
+			}
+			reader := &quill.ViewCommand[ReadFloatArrView]{
+				Action: func(view *ReadFloatArrView) error {
+					record("read")
+					return nil
+				},
+			}
+
+			// ACT ============================================================
+			dataSource.Submit(holder)
+			if tc.writerFirst {
+				dataSource.Run(writer, reader)
+			} else {
+				dataSource.Run(reader, writer)
+			}
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+
+			// ASSERT =========================================================
+			assert.NoError(t, dataSource.Close())
+			assert.Equal(t, tc.order, order)
+		})
+	}
+}
+
+func TestScheduler_Priority(t *testing.T) {
+	type WriteFloatArrView struct {
+		FloatArr []float64
+	}
+
+	tests := map[string]struct {
+		aging time.Duration
+		order []string
+	}{
+		"higher priority passes waiting commands": {
+			aging: time.Hour,
+			order: []string{"high", "low 1", "low 2"},
+		},
+		"commands waiting long enough pass higher priorities": {
+			aging: time.Millisecond,
+			order: []string{"low 1", "low 2", "high"},
+		},
+		"no aging": {
+			aging: 0,
+			order: []string{"high", "low 1", "low 2"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			dataSource := quill.NewDataSource(NastyData{
+				FloatArr: []float64{1, 2, 3},
+			}, quill.WithPoolSize(4), quill.WithPriorityAging(tc.aging))
+
+			release := make(chan struct{})
+			orderLock := sync.Mutex{}
+			order := make([]string, 0)
+			writer := func(entry string) quill.Command {
+				return &quill.ViewCommand[WriteFloatArrView]{
+					Action: func(view *WriteFloatArrView) error {
+						orderLock.Lock()
+						defer orderLock.Unlock()
+						order = append(order, entry)
+						return nil
+					},
+				}
+			}
+
+			// ACT ============================================================
+			dataSource.Submit(&quill.ViewCommand[WriteFloatArrView]{
+				Action: func(view *WriteFloatArrView) error {
+					<-release
+					return nil
+				},
+			})
+			dataSource.Run(writer("low 1"), writer("low 2"))
+			time.Sleep(50 * time.Millisecond)
+			dataSource.SubmitWithPriority(10, writer("high"))
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+
+			// ASSERT =========================================================
+			assert.NoError(t, dataSource.Close())
+			assert.Equal(t, tc.order, order)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package quill
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Half open interval of indices within a slice. An end of -1 means the range
+// extends to the end of the slice, whatever its length happens to be.
+type sliceRange struct {
+	start, end int
+}
+
+// Parses ranges written like Go slice expressions without the brackets, such
+// as "0:50", ":50" or "50:"
+func parseSliceRange(text string) (sliceRange, error) {
+	startText, endText, ok := strings.Cut(text, ":")
+	if !ok {
+		return sliceRange{}, fmt.Errorf("range '%s' must be of the form 'start:end'", text)
+	}
+
+	r := sliceRange{start: 0, end: -1}
+	if startText != "" {
+		start, err := strconv.Atoi(startText)
+		if err != nil {
+			return r, fmt.Errorf("range '%s' has an invalid start: %w", text, err)
+		}
+		r.start = start
+	}
+
+	if endText != "" {
+		end, err := strconv.Atoi(endText)
+		if err != nil {
+			return r, fmt.Errorf("range '%s' has an invalid end: %w", text, err)
+		}
+		r.end = end
+	}
+
+	if r.start < 0 || (r.end != -1 && r.end < r.start) {
+		return r, fmt.Errorf("range '%s' does not contain a valid interval", text)
+	}
+	return r, nil
+}
+
+// Segment appended to a slice's permission path to restrict the permission to
+// the range
+func (r sliceRange) segment() string {
+	if r.end == -1 {
+		return fmt.Sprintf("[%d:]", r.start)
+	}
+	return fmt.Sprintf("[%d:%d]", r.start, r.end)
+}
+
+// Interprets a permission path segment as a range, if it is one
+func rangeFromSegment(segment string) (sliceRange, bool) {
+	if len(segment) < 2 || segment[0] != '[' || segment[len(segment)-1] != ']' {
+		return sliceRange{}, false
+	}
+	r, err := parseSliceRange(segment[1 : len(segment)-1])
+	return r, err == nil
+}
+
+func (r sliceRange) upper() int {
+	if r.end == -1 {
+		return math.MaxInt
+	}
+	return r.end
+}
+
+// Whether or not the two ranges share any index. Empty ranges share nothing.
+func (r sliceRange) overlaps(other sliceRange) bool {
+	if r.start == r.upper() || other.start == other.upper() {
+		return false
+	}
+	return r.start < other.upper() && other.start < r.upper()
+}
+
+// Resolves the range against a slice of the provided length
+func (r sliceRange) bounds(length int) (int, int, error) {
+	end := r.end
+	if end == -1 {
+		end = length
+	}
+	if r.start > length || end > length {
+		return 0, 0, fmt.Errorf("range %s is out of bounds for a slice of length %d", r.segment(), length)
+	}
+	return r.start, end, nil
+}
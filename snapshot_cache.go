@@ -0,0 +1,172 @@
+package quill
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Version of a field within the source that commands are reading as a
+// snapshot. Until a writer comes along, the field itself is the snapshot.
+type snapshot struct {
+	location []pathStep
+	version  uint64
+	readers  int
+}
+
+// Snapshot held by a job, by the path it was taken of
+type heldSnapshot struct {
+	path     string
+	snapshot *snapshot
+}
+
+// Snapshots whose readers are still reading the field within the source.
+// Snapshots are dropped from the cache as soon as a writer is handed a copy
+// of the field, or once the last command reading them has finished.
+type snapshotCache struct {
+	lock        sync.Mutex
+	entries     map[string]*snapshot
+	lastVersion uint64
+}
+
+func newSnapshotCache() *snapshotCache {
+	return &snapshotCache{
+		entries: make(map[string]*snapshot),
+	}
+}
+
+// Latest snapshot of the field at the path, starting a new one if no one is
+// reading the field as it currently is. The caller must be holding read
+// access to the path.
+func (sc *snapshotCache) take(path string, location []pathStep) *snapshot {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if entry, ok := sc.entries[path]; ok {
+		entry.readers++
+		return entry
+	}
+
+	sc.lastVersion++
+	entry := &snapshot{
+		location: location,
+		version:  sc.lastVersion,
+		readers:  1,
+	}
+	sc.entries[path] = entry
+	return entry
+}
+
+func (sc *snapshotCache) release(path string, entry *snapshot) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	entry.readers--
+	if entry.readers == 0 && sc.entries[path] == entry {
+		delete(sc.entries, path)
+	}
+}
+
+// Whether or not the permissions write to a field still being read as a
+// snapshot while other commands hold some of the field. Nothing can be
+// writing to the field while it's copied, nor reading the parts of it that
+// copying replaces, so writers have to wait until the field is free.
+func (sc *snapshotCache) blocks(permissions map[string]PermissionType, table *PermissionTable) bool {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	for snapshotPath := range sc.entries {
+		if snapshotWritten(snapshotPath, permissions) && table.Conflicts(map[string]PermissionType{snapshotPath: WritePermissionType}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Drops every snapshot of data the permissions are about to change,
+// returning where the data lives within the source so it can be copied out
+// from underneath the snapshot's readers.
+func (sc *snapshotCache) detach(permissions map[string]PermissionType) [][]pathStep {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	var locations [][]pathStep
+	for snapshotPath, entry := range sc.entries {
+		if snapshotWritten(snapshotPath, permissions) {
+			locations = append(locations, entry.location)
+			delete(sc.entries, snapshotPath)
+		}
+	}
+	return locations
+}
+
+func snapshotWritten(snapshotPath string, permissions map[string]PermissionType) bool {
+	for path, perm := range permissions {
+		if perm != ReadPermissionType && pathsOverlap(snapshotPath, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the data at the location within the source with a copy of itself,
+// so writing to the source no longer changes the data anyone was handed
+// before the copy.
+func copyInPlace(source reflect.Value, steps []pathStep) {
+	if source.Kind() == reflect.Pointer {
+		if !source.IsNil() {
+			copyInPlace(source.Elem(), steps)
+		}
+		return
+	}
+
+	if len(steps) == 0 {
+		if source.CanSet() {
+			source.Set(cloneValue(source))
+		}
+		return
+	}
+
+	switch source.Kind() {
+	case reflect.Struct:
+		copyInPlace(source.Field(steps[0].field), steps[1:])
+
+	case reflect.Map:
+		key := steps[0].key
+		entry, found := getMapValue(source, key)
+		if !found {
+			return
+		}
+
+		// Entries can't be assigned to in place, so the entry is copied out,
+		// modified and then stored
+		copied := reflect.New(source.Type().Elem()).Elem()
+		copied.Set(entry)
+		copyInPlace(copied, steps[1:])
+		source.SetMapIndex(key, copied)
+	}
+}
+
+// Whether or not the copy cloneValue makes of values of the type shares no
+// memory with the original. Values behind pointers, interfaces and unexported
+// fields are shared rather than copied.
+func snapshotCopyable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return false
+	case reflect.Slice, reflect.Array:
+		return snapshotCopyable(t.Elem())
+	case reflect.Map:
+		return snapshotCopyable(t.Key()) && snapshotCopyable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !snapshotCopyable(field.Type) {
+				return false
+			}
+			if !field.IsExported() && holdsReferences(field.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
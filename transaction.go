@@ -0,0 +1,244 @@
+package quill
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Commands submitted together that either all have their changes stored in
+// the source, or none do.
+type transaction struct {
+	members []*transactionMember
+
+	// Where the data each of the transaction's permissions refers to lives
+	// within the source
+	locations map[string][]pathStep
+}
+
+type transactionMember struct {
+	command     Command
+	index       int
+	commandData any
+	plan        *viewPlan
+}
+
+// Single set of permissions covering everything the transaction's commands
+// require. Anything that isn't read is written, as the transaction replaces
+// whatever it touches once it commits. Ranges are widened to the entire
+// slice, and paths nested within another path are folded into it, so no two
+// paths overlap. Widened paths share the location of the range they were
+// widened from, and are added to the locations provided.
+func transactionPermissions(sets []map[string]PermissionType, locations map[string][]pathStep) map[string]PermissionType {
+	widened := make(map[string]PermissionType)
+	for _, permissions := range sets {
+		for path, perm := range permissions {
+			if parent, segment := splitLastSegment(path); parent != "" {
+				if _, ok := rangeFromSegment(segment); ok {
+					locations[parent] = locations[path]
+					path = parent
+				}
+			}
+			if perm != ReadPermissionType || widened[path] == WritePermissionType {
+				perm = WritePermissionType
+			}
+			widened[path] = perm
+		}
+	}
+
+	paths := make([]string, 0, len(widened))
+	for path := range widened {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return len(paths[i]) < len(paths[j])
+	})
+
+	merged := make(map[string]PermissionType, len(widened))
+	for _, path := range paths {
+		ancestor, ok := "", false
+		segments := strings.Split(path, ".")
+		for i := 2; i < len(segments) && !ok; i++ {
+			ancestor = strings.Join(segments[:i], ".")
+			_, ok = merged[ancestor]
+		}
+
+		if !ok {
+			merged[path] = widened[path]
+			continue
+		}
+		if widened[path] == WritePermissionType {
+			merged[ancestor] = WritePermissionType
+		}
+	}
+	return merged
+}
+
+// Builds a private copy of the parts of the source the permissions cover for
+// the transaction to run against. Written fields are copied deeply enough
+// that changes made to them in place don't reach the source.
+func buildShadow(source reflect.Value, permissions map[string]PermissionType, locations map[string][]pathStep) reflect.Value {
+	shadow := reflect.New(source.Type()).Elem()
+	for path, perm := range permissions {
+		shadowPath(source, shadow, locations[path], perm == WritePermissionType)
+	}
+	return shadow
+}
+
+func shadowPath(source, shadow reflect.Value, steps []pathStep, write bool) {
+	if len(steps) == 0 {
+		if write {
+			shadow.Set(cloneValue(source))
+		} else {
+			shadow.Set(source)
+		}
+		return
+	}
+
+	switch source.Kind() {
+	case reflect.Pointer:
+		if source.IsNil() {
+			return
+		}
+		if shadow.IsNil() {
+			shadow.Set(reflect.New(source.Type().Elem()))
+		}
+		shadowPath(source.Elem(), shadow.Elem(), steps, write)
+
+	case reflect.Struct:
+		shadowPath(source.Field(steps[0].field), shadow.Field(steps[0].field), steps[1:], write)
+
+	case reflect.Map:
+		if source.IsNil() {
+			return
+		}
+		if shadow.IsNil() {
+			shadow.Set(reflect.MakeMap(source.Type()))
+		}
+
+		key := steps[0].key
+		entry, found := getMapValue(source, key)
+		if !found {
+			return
+		}
+
+		// Entries can't be assigned to in place, so the shadow's entry is
+		// built up separately and then stored
+		shadowEntry := reflect.New(source.Type().Elem()).Elem()
+		if existing, ok := getMapValue(shadow, key); ok {
+			shadowEntry.Set(existing)
+		}
+		shadowPath(entry, shadowEntry, steps[1:], write)
+		shadow.SetMapIndex(key, shadowEntry)
+	}
+}
+
+// Stores what the transaction wrote to the shadow back in the source. Map
+// entries are stored individually so entries held by other commands are left
+// untouched.
+func commitPath(source, shadow reflect.Value, steps []pathStep) {
+	if len(steps) == 0 {
+		source.Set(shadow)
+		return
+	}
+
+	switch source.Kind() {
+	case reflect.Pointer:
+		if source.IsNil() || shadow.IsNil() {
+			return
+		}
+		commitPath(source.Elem(), shadow.Elem(), steps)
+
+	case reflect.Struct:
+		commitPath(source.Field(steps[0].field), shadow.Field(steps[0].field), steps[1:])
+
+	case reflect.Map:
+		key := steps[0].key
+		shadowEntry, found := reflect.Value{}, false
+		if !shadow.IsNil() {
+			shadowEntry, found = getMapValue(shadow, key)
+		}
+		if !found {
+			if !source.IsNil() {
+				source.SetMapIndex(key, reflect.Value{})
+			}
+			return
+		}
+
+		if source.IsNil() {
+			source.Set(reflect.MakeMap(source.Type()))
+		}
+		entry := reflect.New(source.Type().Elem()).Elem()
+		if existing, ok := getMapValue(source, key); ok {
+			entry.Set(existing)
+		}
+		commitPath(entry, shadowEntry, steps[1:])
+		source.SetMapIndex(key, entry)
+	}
+}
+
+// Copies the value along with any slices, maps and arrays it holds, so that
+// modifying the copy in place never modifies the original. Values behind
+// pointers are shared.
+func cloneValue(val reflect.Value) reflect.Value {
+	switch val.Kind() {
+	case reflect.Slice:
+		if val.IsNil() {
+			return val
+		}
+		clone := reflect.MakeSlice(val.Type(), val.Len(), val.Len())
+		reflect.Copy(clone, val)
+		if holdsReferences(val.Type().Elem()) {
+			for i := 0; i < val.Len(); i++ {
+				clone.Index(i).Set(cloneValue(val.Index(i)))
+			}
+		}
+		return clone
+
+	case reflect.Map:
+		if val.IsNil() {
+			return val
+		}
+		clone := reflect.MakeMapWithSize(val.Type(), val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			clone.SetMapIndex(iter.Key(), cloneValue(iter.Value()))
+		}
+		return clone
+
+	case reflect.Array, reflect.Struct:
+		clone := reflect.New(val.Type()).Elem()
+		clone.Set(val)
+		if val.Kind() == reflect.Array {
+			for i := 0; i < val.Len(); i++ {
+				clone.Index(i).Set(cloneValue(val.Index(i)))
+			}
+			return clone
+		}
+		for i := 0; i < val.NumField(); i++ {
+			if clone.Field(i).CanSet() {
+				clone.Field(i).Set(cloneValue(val.Field(i)))
+			}
+		}
+		return clone
+	}
+	return val
+}
+
+// Whether or not values of the type can hold slices or maps that cloneValue
+// has to copy
+func holdsReferences(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map:
+		return true
+	case reflect.Array:
+		return holdsReferences(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if holdsReferences(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,475 @@
+package quill_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+type DoubleFloatArrView struct {
+	FloatArr []float64
+}
+
+type AppendStrArrView struct {
+	StrArr *quill.ArrayAppendPermission[string]
+}
+
+type WriteStrView struct {
+	Sub struct {
+		Str *quill.WritePermission[string]
+	}
+}
+
+func TestDataSource_SubmitTransaction_Commits(t *testing.T) {
+	// ARRANGE ================================================================
+	type SumView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+		Sub      *quill.ItemReadPermission[struct {
+			IntArr []int
+			Str    string
+		}]
+	}
+
+	data := &NastyData{
+		FloatArr: []float64{1, 2, 3},
+		StrArr:   []string{"a"},
+	}
+	dataSource := quill.NewDataSource(data)
+	sum := 0.
+	str := ""
+
+	// ACT ====================================================================
+	err := dataSource.SubmitTransaction(
+		&quill.ViewCommand[DoubleFloatArrView]{
+			Action: func(view *DoubleFloatArrView) error {
+				for i := range view.FloatArr {
+					view.FloatArr[i] *= 2
+				}
+				return nil
+			},
+		},
+		&quill.ViewCommand[AppendStrArrView]{
+			Action: func(view *AppendStrArrView) error {
+				view.StrArr.Append("b", "c")
+				return nil
+			},
+		},
+		&quill.ViewCommand[WriteStrView]{
+			Action: func(view *WriteStrView) error {
+				view.Sub.Str.Write("written")
+				return nil
+			},
+		},
+		// Sees the changes of every command before it
+		&quill.ViewCommand[SumView]{
+			Action: func(view *SumView) error {
+				for i := 0; i < view.FloatArr.Value().Len(); i++ {
+					sum += view.FloatArr.Value().At(i)
+				}
+				str = view.Sub.Value().Str
+				return nil
+			},
+		},
+	).Wait()
+	closeErr := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, closeErr)
+	assert.Equal(t, 12., sum)
+	assert.Equal(t, "written", str)
+	assert.Equal(t, []float64{2, 4, 6}, data.FloatArr)
+	assert.Equal(t, []string{"a", "b", "c"}, data.StrArr)
+	assert.Equal(t, "written", data.Sub.Str)
+}
+
+func TestDataSource_SubmitTransaction_RollsBack(t *testing.T) {
+	failure := errors.New("something went wrong")
+
+	tests := map[string]struct {
+		last quill.Command
+	}{
+		"error": {
+			last: &quill.ViewCommand[WriteStrView]{
+				Action: func(view *WriteStrView) error {
+					return failure
+				},
+			},
+		},
+		"panic": {
+			last: &quill.ViewCommand[WriteStrView]{
+				Action: func(view *WriteStrView) error {
+					panic(failure)
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// ARRANGE ========================================================
+			data := &NastyData{
+				FloatArr: []float64{1, 2, 3},
+				StrArr:   []string{"a"},
+			}
+			data.Sub.Str = "original"
+			dataSource := quill.NewDataSource(data)
+
+			// ACT ============================================================
+			err := dataSource.SubmitTransaction(
+				&quill.ViewCommand[DoubleFloatArrView]{
+					Action: func(view *DoubleFloatArrView) error {
+						for i := range view.FloatArr {
+							view.FloatArr[i] *= 2
+						}
+						return nil
+					},
+				},
+				&quill.ViewCommand[AppendStrArrView]{
+					Action: func(view *AppendStrArrView) error {
+						view.StrArr.Append("b")
+						return nil
+					},
+				},
+				&quill.ViewCommand[WriteStrView]{
+					Action: func(view *WriteStrView) error {
+						view.Sub.Str.Write("written")
+						return nil
+					},
+				},
+				tc.last,
+			).Wait()
+			closeErr := dataSource.Close()
+
+			// ASSERT =========================================================
+			assert.ErrorIs(t, err, failure)
+			var commandErr quill.CommandError
+			if assert.ErrorAs(t, err, &commandErr) {
+				assert.Equal(t, 3, commandErr.Index)
+			}
+			assert.ErrorIs(t, closeErr, failure)
+			assert.Equal(t, []float64{1, 2, 3}, data.FloatArr)
+			assert.Equal(t, []string{"a"}, data.StrArr)
+			assert.Equal(t, "original", data.Sub.Str)
+		})
+	}
+}
+
+func TestDataSource_SubmitTransaction_Maps(t *testing.T) {
+	// ARRANGE ================================================================
+	type FinalPriceView struct {
+		Columns struct {
+			BasePrice   []float64
+			FinalPrices []float64
+		}
+	}
+	type TitleView struct {
+		Title *quill.ItemReadPermission[string]
+	}
+
+	tests := map[string]struct {
+		fail    bool
+		columns map[string][]float64
+	}{
+		"commits": {
+			fail: false,
+			columns: map[string][]float64{
+				"BasePrice":   {20, 40},
+				"FinalPrices": {22, 44},
+				"Extra":       {1},
+			},
+		},
+		"rolls back": {
+			fail: true,
+			columns: map[string][]float64{
+				"BasePrice": {10, 20},
+				"Price":     {3},
+				"Extra":     {1},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := CSVData{
+				Columns: map[string][]float64{
+					"BasePrice": {10, 20},
+					"Price":     {3},
+					"Extra":     {1},
+				},
+			}
+			dataSource := quill.NewDataSource(data)
+
+			deleteCommand := &quill.ViewCommand[ColumnsView]{
+				Action: func(view *ColumnsView) error {
+					view.Columns.Delete("Price")
+					return nil
+				},
+			}
+			deleteCommand.View().Columns = quill.NewMapKeys[string, []float64](quill.WritePermissionType, "Price")
+
+			// ACT ============================================================
+			err := dataSource.SubmitTransaction(
+				&quill.ViewCommand[FinalPriceView]{
+					Action: func(view *FinalPriceView) error {
+						view.Columns.FinalPrices = make([]float64, len(view.Columns.BasePrice))
+						for i, price := range view.Columns.BasePrice {
+							view.Columns.BasePrice[i] = price * 2
+							view.Columns.FinalPrices[i] = price * 2.2
+						}
+						return nil
+					},
+				},
+				deleteCommand,
+				&quill.ViewCommand[TitleView]{
+					Action: func(view *TitleView) error {
+						if tc.fail {
+							return errors.New("something went wrong")
+						}
+						return nil
+					},
+				},
+			).Wait()
+			dataSource.Close()
+
+			// ASSERT =========================================================
+			if tc.fail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, data.Columns, len(tc.columns))
+			for key, column := range tc.columns {
+				assert.InDeltaSlice(t, column, data.Columns[key], 1e-9)
+			}
+		})
+	}
+}
+
+func TestDataSource_SubmitTransaction_OverlappingViews(t *testing.T) {
+	// ARRANGE ================================================================
+	type FirstHalfView struct {
+		Half *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"0:2"`
+	}
+	type SecondHalfView struct {
+		Half *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"2:"`
+	}
+	type ReadSubView struct {
+		Sub *quill.ItemReadPermission[struct {
+			IntArr []int
+			Str    string
+		}]
+	}
+
+	data := &NastyData{FloatArr: []float64{1, 2, 3, 4}}
+	dataSource := quill.NewDataSource(data)
+	str := ""
+
+	// ACT ====================================================================
+	err := dataSource.SubmitTransaction(
+		&quill.ViewCommand[FirstHalfView]{
+			Action: func(view *FirstHalfView) error {
+				view.Half.Value()[0] = 10
+				return nil
+			},
+		},
+		&quill.ViewCommand[SecondHalfView]{
+			Action: func(view *SecondHalfView) error {
+				view.Half.Value()[0] = 30
+				return nil
+			},
+		},
+		&quill.ViewCommand[WriteStrView]{
+			Action: func(view *WriteStrView) error {
+				view.Sub.Str.Write("written")
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadSubView]{
+			Action: func(view *ReadSubView) error {
+				str = view.Sub.Value().Str
+				return nil
+			},
+		},
+	).Wait()
+	closeErr := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, closeErr)
+	assert.Equal(t, []float64{10, 2, 30, 4}, data.FloatArr)
+	assert.Equal(t, "written", data.Sub.Str)
+	assert.Equal(t, "written", str)
+}
+
+func TestDataSource_SubmitTransaction_InvalidView(t *testing.T) {
+	// ARRANGE ================================================================
+	type BadView struct {
+		DoesNotExist *quill.ArrayReadPermission[float64]
+	}
+
+	data := &NastyData{FloatArr: []float64{1}}
+	dataSource := quill.NewDataSource(data)
+
+	// ACT ====================================================================
+	err := dataSource.SubmitTransaction(
+		&quill.ViewCommand[DoubleFloatArrView]{
+			Action: func(view *DoubleFloatArrView) error {
+				view.FloatArr[0] = 2
+				return nil
+			},
+		},
+		&quill.ViewCommand[BadView]{
+			Action: func(view *BadView) error {
+				return nil
+			},
+		},
+	).Wait()
+	dataSource.Close()
+
+	// ASSERT =================================================================
+	var commandErr quill.CommandError
+	if assert.ErrorAs(t, err, &commandErr) {
+		assert.Equal(t, 1, commandErr.Index)
+	}
+	assert.Equal(t, []float64{1}, data.FloatArr)
+}
+
+func TestDataSource_SubmitTransaction_LeavesOtherEntriesAlone(t *testing.T) {
+	// ARRANGE ================================================================
+	type CounterData struct {
+		Counts map[string][]int
+	}
+	type CountView struct {
+		Counts *quill.MapKeys[string, []int]
+	}
+
+	data := &CounterData{
+		Counts: map[string][]int{"a": {0}, "b": {0}},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	increment := func(key string) *quill.ViewCommand[CountView] {
+		command := &quill.ViewCommand[CountView]{
+			Action: func(view *CountView) error {
+				counts, _ := view.Counts.Get(key)
+				view.Counts.Set(key, []int{counts[0] + 1})
+				return nil
+			},
+		}
+		command.View().Counts = quill.NewMapKeys[string, []int](quill.WritePermissionType, key)
+		return command
+	}
+
+	// ACT ====================================================================
+	futures := make([]*quill.Future, 0)
+	for i := 0; i < 50; i++ {
+		futures = append(futures, dataSource.SubmitTransaction(increment("a")))
+		futures = append(futures, dataSource.Submit(increment("b")))
+	}
+	err := quill.WaitAll(futures...)
+	dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, []int{50}, data.Counts["a"])
+	assert.Equal(t, []int{50}, data.Counts["b"])
+}
+
+func TestDataSource_SubmitTransaction_MapKeysThatAreNotNames(t *testing.T) {
+	// ARRANGE ================================================================
+	type Cell struct {
+		Row, Column int
+	}
+
+	type Sheet struct {
+		Columns map[string][]float64
+		Cells   map[Cell]string
+	}
+
+	type CellsView struct {
+		Cells *quill.MapKeys[Cell, string]
+	}
+
+	data := &Sheet{
+		Columns: map[string][]float64{
+			"price.usd": {10, 20},
+			"price":     {1},
+		},
+		Cells: map[Cell]string{
+			{Row: 0, Column: 0}: "A1",
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+
+	doubleCommand := &quill.ViewCommand[ColumnsView]{
+		Action: func(view *ColumnsView) error {
+			prices, _ := view.Columns.Get("price.usd")
+			doubled := make([]float64, len(prices))
+			for i, price := range prices {
+				doubled[i] = price * 2
+			}
+			view.Columns.Set("price.usd", doubled)
+			return nil
+		},
+	}
+	doubleCommand.View().Columns = quill.NewMapKeys[string, []float64](quill.WritePermissionType, "price.usd")
+
+	cellsCommand := &quill.ViewCommand[CellsView]{
+		Action: func(view *CellsView) error {
+			value, _ := view.Cells.Get(Cell{Row: 0, Column: 0})
+			view.Cells.Set(Cell{Row: 0, Column: 1}, value+"!")
+			return nil
+		},
+	}
+	cellsCommand.View().Cells = quill.NewMapKeys[Cell, string](quill.WritePermissionType, Cell{Row: 0, Column: 0}, Cell{Row: 0, Column: 1})
+
+	// ACT ====================================================================
+	err := dataSource.SubmitTransaction(doubleCommand, cellsCommand).Wait()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []float64{20, 40}, data.Columns["price.usd"])
+	assert.Equal(t, []float64{1}, data.Columns["price"])
+	assert.Equal(t, map[Cell]string{
+		{Row: 0, Column: 0}: "A1",
+		{Row: 0, Column: 1}: "A1!",
+	}, data.Cells)
+}
+
+func TestDataSource_SubmitTransaction_RollsBackMapWrites(t *testing.T) {
+	// ARRANGE ================================================================
+	type WholeColumnsView struct {
+		Columns *quill.MapWritePermission[string, []float64]
+	}
+
+	data := &CSVData{
+		Columns: map[string][]float64{
+			"BasePrice": {10, 20},
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+
+	// ACT ====================================================================
+	err := dataSource.SubmitTransaction(
+		&quill.ViewCommand[WholeColumnsView]{
+			Action: func(view *WholeColumnsView) error {
+				view.Columns.Delete("BasePrice")
+				view.Columns.Set("Price", []float64{1})
+				return nil
+			},
+		},
+		&quill.ViewCommand[WholeColumnsView]{
+			Action: func(view *WholeColumnsView) error {
+				return errors.New("something went wrong")
+			},
+		},
+	).Wait()
+
+	// ASSERT =================================================================
+	assert.Error(t, err)
+	assert.Error(t, dataSource.Close())
+	assert.Equal(t, map[string][]float64{"BasePrice": {10, 20}}, data.Columns)
+}
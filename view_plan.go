@@ -0,0 +1,755 @@
+package quill
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type fieldPlanKind int
+
+const (
+	// View's slice aliases the source's slice
+	sliceFieldPlan fieldPlanKind = iota
+
+	// View's pointer is a permission injected with the source's data
+	permissionFieldPlan
+
+	// View's struct is populated by a struct within the source
+	structFieldPlan
+
+	// View's struct is populated by entries of a map within the source
+	mapFieldPlan
+)
+
+// Precomputed instructions for populating a single field of a view
+type fieldPlan struct {
+	kind fieldPlanKind
+
+	// Path to the field within the view, used for reporting errors
+	viewPath  string
+	viewKind  reflect.Kind
+	viewIndex int
+
+	// Where the data lives within the parent source. Struct sources index
+	// their fields, map sources look up entries by key.
+	sourceIndex int
+	mapKey      reflect.Value
+
+	// Number of pointers that need following within the source to arrive at
+	// the data
+	derefs int
+
+	// Type the view field's permission pointer points to
+	permission reflect.Type
+	writeBack  bool
+
+	// Path the permission appends to, if it's an append permission
+	appendPath string
+
+	// Portion of the source's slice the view field is restricted to
+	ranged     bool
+	sliceRange sliceRange
+
+	// Permission is created by the command ahead of time rather than by us
+	preset bool
+
+	// Paths of the permission depend on how the command set it up
+	dynamic bool
+
+	fields []fieldPlan
+}
+
+// Precomputed instructions for populating a specific view type with a
+// specific source type, so the view's structure only has to be walked with
+// reflection once.
+type viewPlan struct {
+	permissions map[string]PermissionType
+	fields      []fieldPlan
+	dynamic     []dynamicFieldPlan
+	snapshots   []snapshotFieldPlan
+
+	// Where the data each permission refers to lives within the source
+	locations map[string][]pathStep
+
+	// Whether or not populating the view reads from any map within the
+	// source
+	readsMaps bool
+}
+
+// Step taken from a value to arrive at data nested within it, either a field
+// of a struct or an entry of a map
+type pathStep struct {
+	field int
+	key   reflect.Value
+}
+
+// Appends the step to a copy of the steps, so paths sharing a parent never
+// share a backing array
+func appendStep(steps []pathStep, step pathStep) []pathStep {
+	return append(append(make([]pathStep, 0, len(steps)+1), steps...), step)
+}
+
+// Permission within the view whose paths depend on how the command set it up
+type dynamicFieldPlan struct {
+	viewPath       string
+	viewIndices    []int
+	permissionPath string
+	location       []pathStep
+}
+
+// Permission within the view that reads from a snapshot of the source
+type snapshotFieldPlan struct {
+	viewIndices    []int
+	permissionPath string
+	location       []pathStep
+}
+
+type viewPlanKey struct {
+	source, view reflect.Type
+}
+
+// Thread safe cache of compiled plans
+type viewPlanCache struct {
+	plans sync.Map
+}
+
+func (vpc *viewPlanCache) get(sourceType, viewType reflect.Type) (*viewPlan, error) {
+	key := viewPlanKey{source: sourceType, view: viewType}
+	if plan, ok := vpc.plans.Load(key); ok {
+		return plan.(*viewPlan), nil
+	}
+
+	plan, err := compileViewPlan(sourceType, viewType)
+	if err != nil {
+		return nil, err
+	}
+	vpc.plans.Store(key, plan)
+	return plan, nil
+}
+
+// Follows pointer types until arriving at a type that is not a pointer,
+// returning how many pointers had to be followed
+func indirectType(t reflect.Type) (reflect.Type, int) {
+	derefs := 0
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		derefs++
+	}
+	return t, derefs
+}
+
+// Name of the data within the source the view's field refers to
+func sourceNameOf(field reflect.StructField) string {
+	if altName, ok := field.Tag.Lookup("quill"); ok {
+		return altName
+	}
+	return field.Name
+}
+
+func compileViewPlan(sourceType, viewType reflect.Type) (*viewPlan, error) {
+	if viewType.Kind() != reflect.Pointer {
+		return nil, ViewError{
+			ViewKind:   viewType.Kind(),
+			SourceKind: sourceType.Kind(),
+			Reason:     "views must be passed by pointer",
+		}
+	}
+
+	viewType = viewType.Elem()
+	if viewType.Kind() != reflect.Struct {
+		return nil, ViewError{
+			ViewKind:   viewType.Kind(),
+			SourceKind: sourceType.Kind(),
+			Reason:     "views must be structs",
+		}
+	}
+
+	sourceType, _ = indirectType(sourceType)
+	if sourceType.Kind() != reflect.Struct {
+		return nil, ViewError{
+			ViewKind:   viewType.Kind(),
+			SourceKind: sourceType.Kind(),
+			Reason:     "sources must be structs",
+		}
+	}
+
+	plan := &viewPlan{
+		permissions: make(map[string]PermissionType),
+		locations:   make(map[string][]pathStep),
+	}
+	fields, err := compileFields("", "", nil, nil, sourceType, viewType, plan)
+	if err != nil {
+		return nil, err
+	}
+	plan.fields = fields
+	return plan, nil
+}
+
+// Builds the plan for each field of the view, where the source is either a
+// struct whose fields populate the view, or a map whose entries populate the
+// view.
+func compileFields(viewPath, permissionPath string, viewIndices []int, location []pathStep, sourceType, viewType reflect.Type, plan *viewPlan) ([]fieldPlan, error) {
+	fields := make([]fieldPlan, 0, viewType.NumField())
+	fromMap := sourceType.Kind() == reflect.Map
+	if fromMap {
+		plan.readsMaps = true
+	}
+
+	for i := 0; i < viewType.NumField(); i++ {
+		structField := viewType.Field(i)
+		fp := fieldPlan{
+			viewPath:  fmt.Sprintf("%s.%s", viewPath, structField.Name),
+			viewKind:  structField.Type.Kind(),
+			viewIndex: i,
+		}
+		if !structField.IsExported() {
+			return nil, unassignableFieldError(fp.viewPath, fp.viewKind)
+		}
+
+		sourceName := sourceNameOf(structField)
+		fieldPermissionPath := fmt.Sprintf("%s.%s", permissionPath, sourceName)
+
+		var sourceFieldType reflect.Type
+		var fieldLocation []pathStep
+		if fromMap {
+			key, err := mapKeyFromName(sourceName, sourceType.Key())
+			if err != nil {
+				return nil, ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: reflect.Map,
+					Reason:     fmt.Sprintf("can not use '%s' as a key: %s", sourceName, err.Error()),
+				}
+			}
+			fp.mapKey = key
+			sourceFieldType = sourceType.Elem()
+			fieldLocation = appendStep(location, pathStep{key: key})
+
+			// Entries are identified by their key rather than how the view
+			// spelled it, so "5" and "05" refer to the same entry
+			fieldPermissionPath = fmt.Sprintf("%s.%s", permissionPath, mapKeySegment(key.Interface()))
+		} else {
+			sourceField, ok := fieldByName(sourceType, sourceName)
+			if !ok {
+				return nil, ViewError{
+					Path:     fp.viewPath,
+					ViewKind: fp.viewKind,
+					Reason:   fmt.Sprintf("source does not contain a field named '%s'", sourceName),
+				}
+			}
+			fp.sourceIndex = sourceField.Index[0]
+			sourceFieldType = sourceField.Type
+			fieldLocation = appendStep(location, pathStep{field: fp.sourceIndex})
+		}
+
+		if rangeTag, ok := structField.Tag.Lookup("range"); ok {
+			r, err := parseSliceRange(rangeTag)
+			if err != nil {
+				return nil, ViewError{
+					Path:     fp.viewPath,
+					ViewKind: fp.viewKind,
+					Reason:   err.Error(),
+				}
+			}
+			fp.ranged = true
+			fp.sliceRange = r
+			fieldPermissionPath = fmt.Sprintf("%s.%s", fieldPermissionPath, r.segment())
+		}
+
+		if fp.viewKind == reflect.Struct || fp.viewKind == reflect.Slice {
+			sourceFieldType, fp.derefs = indirectType(sourceFieldType)
+		}
+		sourceFieldKind := sourceFieldType.Kind()
+
+		switch {
+
+		// View is requesting write access to an array from the source data
+		case fp.viewKind == reflect.Slice && sourceFieldKind == reflect.Slice:
+			if !sourceFieldType.AssignableTo(structField.Type) {
+				return nil, ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: sourceFieldKind,
+					Reason:     fmt.Sprintf("%s can not be assigned to %s", sourceFieldType, structField.Type),
+				}
+			}
+			fp.kind = sliceFieldPlan
+			if err := plan.require(fp, fieldPermissionPath, fieldLocation, WritePermissionType); err != nil {
+				return nil, err
+			}
+
+		// View is requesting access through a specific permission
+		case fp.viewKind == reflect.Pointer:
+			perm, ok := reflect.New(structField.Type.Elem()).Interface().(Permission)
+			if !ok {
+				return nil, ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: sourceFieldKind,
+					Reason:     "pointers within views must be permissions",
+				}
+			}
+
+			// Pointers within the source are followed, unless the
+			// permission is over the pointer itself
+			if sourceFieldKind == reflect.Pointer && perm.inject(reflect.New(sourceFieldType).Elem()) != nil {
+				sourceFieldType, fp.derefs = indirectType(sourceFieldType)
+				sourceFieldKind = sourceFieldType.Kind()
+			}
+
+			// Make sure the permission can actually hold the source's data
+			// before we ever try to populate it
+			if err := perm.inject(reflect.New(sourceFieldType).Elem()); err != nil {
+				return nil, ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: sourceFieldKind,
+					Reason:     err.Error(),
+				}
+			}
+			perm.clear()
+
+			if _, ok := perm.(rangePermission); fp.ranged && !ok {
+				return nil, ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: sourceFieldKind,
+					Reason:     "ranges can only be declared on slices and array slice permissions",
+				}
+			}
+
+			if _, ok := perm.(appendPermission); ok {
+				if fromMap {
+					return nil, ViewError{
+						Path:       fp.viewPath,
+						ViewKind:   fp.viewKind,
+						SourceKind: sourceFieldKind,
+						Reason:     "appending to slices within maps is not supported",
+					}
+				}
+				fp.appendPath = fieldPermissionPath
+			}
+
+			// Entries are written back to maps whole, which would lose the
+			// deltas of any other accumulator merging into the same entry
+			if perm.Type() == AccumulatePermissionType && fromMap {
+				return nil, ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: sourceFieldKind,
+					Reason:     "accumulating into map entries is not supported",
+				}
+			}
+
+			_, fp.writeBack = perm.(writeBackPermission)
+			fp.kind = permissionFieldPlan
+			fp.permission = structField.Type.Elem()
+			_, fp.preset = perm.(presetPermission)
+
+			// Paths of dynamic permissions aren't known until the command
+			// has been submitted
+			if _, fp.dynamic = perm.(dynamicPermission); fp.dynamic {
+				plan.dynamic = append(plan.dynamic, dynamicFieldPlan{
+					viewPath:       fp.viewPath,
+					viewIndices:    append(append([]int{}, viewIndices...), i),
+					permissionPath: fieldPermissionPath,
+					location:       fieldLocation,
+				})
+				if sourceFieldKind == reflect.Map {
+					plan.readsMaps = true
+				}
+				break
+			}
+			if err := plan.require(fp, fieldPermissionPath, fieldLocation, perm.Type()); err != nil {
+				return nil, err
+			}
+
+			if _, ok := perm.(snapshotPermission); ok {
+				// Snapshot readers keep reading memory that the copy handed
+				// to writers must not share
+				if !snapshotCopyable(sourceFieldType) {
+					return nil, ViewError{
+						Path:       fp.viewPath,
+						ViewKind:   fp.viewKind,
+						SourceKind: sourceFieldKind,
+						Reason:     fmt.Sprintf("%s can not be snapshotted, as it holds data behind pointers, interfaces, funcs, chans or unexported fields", sourceFieldType),
+					}
+				}
+				plan.snapshots = append(plan.snapshots, snapshotFieldPlan{
+					viewIndices:    append(append([]int{}, viewIndices...), i),
+					permissionPath: fieldPermissionPath,
+					location:       fieldLocation,
+				})
+			}
+
+		case fp.ranged:
+			return nil, ViewError{
+				Path:       fp.viewPath,
+				ViewKind:   fp.viewKind,
+				SourceKind: sourceFieldKind,
+				Reason:     "ranges can only be declared on slices and array slice permissions",
+			}
+
+		case fp.viewKind == reflect.Struct && (sourceFieldKind == reflect.Struct || sourceFieldKind == reflect.Map):
+			subFields, err := compileFields(fp.viewPath, fieldPermissionPath, append(append([]int{}, viewIndices...), i), fieldLocation, sourceFieldType, structField.Type, plan)
+			if err != nil {
+				return nil, err
+			}
+			fp.kind = structFieldPlan
+			if sourceFieldKind == reflect.Map {
+				fp.kind = mapFieldPlan
+			}
+			fp.fields = subFields
+
+		default:
+			return nil, unimplementedScenarioError(fp.viewPath, fp.viewKind, sourceFieldKind)
+		}
+
+		fields = append(fields, fp)
+	}
+
+	return fields, nil
+}
+
+// Records the permission a field of the view requires, making sure no other
+// field of the view already accesses the same data, or data nested within or
+// around it in a way the two fields couldn't share. This keeps a plan's
+// permissions from ever conflicting with one another in the permission table.
+func (vp *viewPlan) require(fp fieldPlan, path string, location []pathStep, perm PermissionType) error {
+	_, duplicate := vp.permissions[path]
+	if duplicate || permissionsConflict(vp.permissions, map[string]PermissionType{path: perm}) {
+		return ViewError{
+			Path:     fp.viewPath,
+			ViewKind: fp.viewKind,
+			Reason:   fmt.Sprintf("'%s' is already accessed by another field of the view", path),
+		}
+	}
+	vp.permissions[path] = perm
+	vp.locations[path] = location
+	return nil
+}
+
+// Permissions required to populate the specific view provided, which on top
+// of the plan's permissions includes the paths of any dynamic permissions the
+// view has set up.
+func (vp *viewPlan) permissionsFor(view any) (map[string]PermissionType, error) {
+	if len(vp.dynamic) == 0 {
+		return vp.permissions, nil
+	}
+
+	permissions := make(map[string]PermissionType, len(vp.permissions))
+	for path, perm := range vp.permissions {
+		permissions[path] = perm
+	}
+
+	viewValue := reflect.ValueOf(view).Elem()
+	for _, df := range vp.dynamic {
+		field := viewValue.FieldByIndex(df.viewIndices)
+		if field.IsNil() {
+			return nil, unsetPresetPermissionError(df.viewPath)
+		}
+
+		perm := field.Interface().(dynamicPermission)
+		if err := perm.validate(); err != nil {
+			return nil, ViewError{
+				Path:     df.viewPath,
+				ViewKind: reflect.Pointer,
+				Reason:   err.Error(),
+			}
+		}
+		for _, key := range perm.entries() {
+			segment := mapKeySegment(key.Interface())
+			path := df.permissionPath + "." + segment
+			newPermission := map[string]PermissionType{path: perm.Type()}
+			if permissionsConflict(permissions, newPermission) {
+				return nil, ViewError{
+					Path:     df.viewPath,
+					ViewKind: reflect.Pointer,
+					Reason:   fmt.Sprintf("'%v' is already accessed by another field of the view", key),
+				}
+			}
+			permissions[path] = perm.Type()
+		}
+	}
+	return permissions, nil
+}
+
+// Where the data each of the permissions required by the view provided lives
+// within the source, including the entries of any dynamic permissions. Assumes
+// the view's permissions have already been checked by permissionsFor.
+func (vp *viewPlan) locationsFor(view any) map[string][]pathStep {
+	if len(vp.dynamic) == 0 {
+		return vp.locations
+	}
+
+	locations := make(map[string][]pathStep, len(vp.locations))
+	for path, location := range vp.locations {
+		locations[path] = location
+	}
+
+	viewValue := reflect.ValueOf(view).Elem()
+	for _, df := range vp.dynamic {
+		perm := viewValue.FieldByIndex(df.viewIndices).Interface().(dynamicPermission)
+		for _, key := range perm.entries() {
+			path := df.permissionPath + "." + mapKeySegment(key.Interface())
+			locations[path] = appendStep(df.location, pathStep{key: key})
+		}
+	}
+	return locations
+}
+
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name == f.Name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Populates the view with the source's data. The source must be addressable
+// for any permission that writes back to the source to apply its changes.
+func (vp *viewPlan) populate(sourceValue reflect.Value, view any) (ApplyChanges, error) {
+	viewValue := reflect.ValueOf(view).Elem()
+	sourceValue, err := indirect(sourceValue, "", viewValue.Kind())
+	if err != nil {
+		return ApplyChanges{}, err
+	}
+
+	ops := make([]postQueryOperation, 0)
+	if err := populateFields(vp.fields, sourceValue, viewValue, &ops); err != nil {
+		return ApplyChanges{}, err
+	}
+	return ApplyChanges{changes: ops}, nil
+}
+
+func populateFields(fields []fieldPlan, source, view reflect.Value, ops *[]postQueryOperation) error {
+	fromMap := source.Kind() == reflect.Map
+
+	for _, fp := range fields {
+		viewField := view.Field(fp.viewIndex)
+
+		var sourceField reflect.Value
+		found := true
+		if fromMap {
+			sourceField, found = getMapValue(source, fp.mapKey)
+		} else {
+			sourceField = source.Field(fp.sourceIndex)
+		}
+
+		if found && fp.derefs > 0 {
+			var err error
+			if sourceField, err = indirect(sourceField, fp.viewPath, fp.viewKind); err != nil {
+				return err
+			}
+		}
+
+		if fp.ranged && !found {
+			return ViewError{
+				Path:       fp.viewPath,
+				ViewKind:   fp.viewKind,
+				SourceKind: reflect.Invalid,
+				Reason:     fmt.Sprintf("map does not contain the key '%v'", fp.mapKey),
+			}
+		}
+
+		switch fp.kind {
+		case sliceFieldPlan:
+			if found && fp.ranged {
+				sub, _, err := fp.sliceWithinRange(sourceField)
+				if err != nil {
+					return err
+				}
+				viewField.Set(sub)
+				continue
+			}
+
+			if found {
+				viewField.Set(sourceField)
+				continue
+			}
+
+			if source.IsNil() {
+				return ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: reflect.Map,
+					Reason:     "can not add an entry to a nil map",
+				}
+			}
+
+			// The entry is only added to the map once the command has
+			// finished, as other commands may be reading the map until then
+			viewField.Set(reflect.New(viewField.Type()).Elem())
+			*ops = append(*ops, updateMapPostQueryOperation{
+				mapSource: source,
+				mapKey:    fp.mapKey,
+				mapVal:    view,
+				field:     fp.viewIndex,
+			})
+
+		case permissionFieldPlan:
+			var perm Permission
+			if fp.preset {
+				// Preset permissions have already been set up by the command
+				if viewField.IsNil() {
+					return unsetPresetPermissionError(fp.viewPath)
+				}
+				perm = viewField.Interface().(Permission)
+				if err := perm.(presetPermission).validate(); err != nil {
+					return ViewError{
+						Path:     fp.viewPath,
+						ViewKind: reflect.Pointer,
+						Reason:   err.Error(),
+					}
+				}
+			} else {
+				newPtr := reflect.New(fp.permission)
+				viewField.Set(newPtr)
+				perm = newPtr.Interface().(Permission)
+			}
+
+			// Map entries can't be assigned to directly, so permissions that
+			// write back to the source are given a copy of the entry that
+			// gets stored back in the map once they've applied their changes.
+			// Entries that are pointers are written through instead.
+			if fromMap && fp.writeBack && fp.derefs == 0 {
+				if source.IsNil() {
+					return ViewError{
+						Path:       fp.viewPath,
+						ViewKind:   fp.viewKind,
+						SourceKind: reflect.Map,
+						Reason:     "can not write an entry to a nil map",
+					}
+				}
+
+				entry := reflect.New(source.Type().Elem()).Elem()
+				if found {
+					entry.Set(sourceField)
+				}
+				if err := injectPermission(perm, entry, fp.viewPath); err != nil {
+					return err
+				}
+				*ops = append(*ops, setMapEntryPostQueryOperation{
+					mapSource: source,
+					mapKey:    fp.mapKey,
+					entry:     entry,
+					perm:      perm.(writeBackPermission),
+				})
+				continue
+			}
+
+			if fp.ranged {
+				sub, start, err := fp.sliceWithinRange(sourceField)
+				if err != nil {
+					return err
+				}
+				if err := perm.(rangePermission).injectRange(sub, start); err != nil {
+					return ViewError{
+						Path:       fp.viewPath,
+						ViewKind:   fp.viewKind,
+						SourceKind: sourceField.Kind(),
+						Reason:     err.Error(),
+					}
+				}
+				continue
+			}
+
+			if err := injectPermission(perm, sourceField, fp.viewPath); err != nil {
+				return err
+			}
+			if fp.appendPath != "" {
+				*ops = append(*ops, appendPostQueryOperation{
+					path: fp.appendPath,
+					perm: perm.(appendPermission),
+				})
+				continue
+			}
+			if fp.writeBack {
+				*ops = append(*ops, perm.(writeBackPermission))
+			}
+
+		case structFieldPlan, mapFieldPlan:
+			if !found {
+				return ViewError{
+					Path:       fp.viewPath,
+					ViewKind:   fp.viewKind,
+					SourceKind: reflect.Invalid,
+					Reason:     fmt.Sprintf("map does not contain the key '%v'", fp.mapKey),
+				}
+			}
+
+			if err := populateFields(fp.fields, sourceField, viewField, ops); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Portion of the source's slice the field's range refers to, along with the
+// index the portion starts at
+func (fp fieldPlan) sliceWithinRange(slice reflect.Value) (reflect.Value, int, error) {
+	if slice.Kind() != reflect.Slice {
+		return slice, 0, ViewError{
+			Path:       fp.viewPath,
+			ViewKind:   fp.viewKind,
+			SourceKind: slice.Kind(),
+			Reason:     "ranges can only be taken of slices",
+		}
+	}
+
+	start, end, err := fp.sliceRange.bounds(slice.Len())
+	if err != nil {
+		return slice, 0, ViewError{
+			Path:       fp.viewPath,
+			ViewKind:   fp.viewKind,
+			SourceKind: slice.Kind(),
+			Reason:     err.Error(),
+		}
+	}
+
+	// Cap the capacity so appending to the range can never clobber elements
+	// outside of it
+	return slice.Slice3(start, end, end), start, nil
+}
+
+func injectPermission(perm Permission, val reflect.Value, path string) error {
+	if err := perm.inject(val); err != nil {
+		return ViewError{
+			Path:       path,
+			ViewKind:   reflect.Pointer,
+			SourceKind: val.Kind(),
+			Reason:     err.Error(),
+		}
+	}
+	return nil
+}
+
+func unsetPresetPermissionError(path string) error {
+	return ViewError{
+		Path:     path,
+		ViewKind: reflect.Pointer,
+		Reason:   "permission must be created before the command is submitted",
+	}
+}
+
+func unassignableFieldError(path string, viewKind reflect.Kind) error {
+	return ViewError{
+		Path:     path,
+		ViewKind: viewKind,
+		Reason:   "field can not be assigned to, is it unexported?",
+	}
+}
+
+func unimplementedScenarioError(path string, viewKind, sourceKind reflect.Kind) error {
+	return ViewError{
+		Path:       path,
+		ViewKind:   viewKind,
+		SourceKind: sourceKind,
+		Reason:     "unimplemented scenario",
+	}
+}
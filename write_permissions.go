@@ -13,13 +13,13 @@ func (awp ArrayWritePermission[T]) Value() []T {
 	return awp.data
 }
 
-func (awp *ArrayWritePermission[T]) inject(val reflect.Value) {
-	t := val.Kind()
-	if t != reflect.Slice {
-		panic(fmt.Errorf("can not populate an array permission with value of type: %s", t.String()))
+func (awp *ArrayWritePermission[T]) inject(val reflect.Value) error {
+	data, err := sliceFromValue[T](val)
+	if err != nil {
+		return err
 	}
-
-	awp.data = val.Interface().([]T)
+	awp.data = data
+	return nil
 }
 
 func (awp *ArrayWritePermission[T]) clear() {
@@ -30,9 +30,173 @@ func (awp ArrayWritePermission[T]) Type() PermissionType {
 	return WritePermissionType
 }
 
+// Permission that buffers elements to append to a slice in the source
+type appendPermission interface {
+	writeBackPermission
+
+	// Takes the buffered elements, returning a function that appends them
+	// to the source
+	detach() func()
+}
+
+// ArrayAppendPermission grants a command the ability to add elements to the
+// end of a slice within the source. Elements appended are buffered until the
+// command has finished, so commands appending to the same slice can run at
+// the same time, with their elements added in the order the commands were
+// started.
+type ArrayAppendPermission[T any] struct {
+	buffer []T
+	target reflect.Value
+}
+
+func (aap *ArrayAppendPermission[T]) Append(values ...T) {
+	aap.buffer = append(aap.buffer, values...)
+}
+
+// Elements appended by the command so far
+func (aap ArrayAppendPermission[T]) Appended() []T {
+	return aap.buffer
+}
+
+func (aap *ArrayAppendPermission[T]) inject(val reflect.Value) error {
+	// Other appenders may be committing to the slice, so only its type is
+	// looked at here
+	var expected []T
+	if !val.IsValid() || val.Type() != reflect.TypeOf(expected) {
+		return fmt.Errorf("can not populate an append permission of %T with a value that is not one", expected)
+	}
+	if !val.CanSet() {
+		return fmt.Errorf("can not populate an append permission with a value that can not be assigned to")
+	}
+	aap.buffer = nil
+	aap.target = val
+	return nil
+}
+
+func (aap *ArrayAppendPermission[T]) clear() {
+	aap.buffer = nil
+	aap.target = reflect.Value{}
+}
+
+func (aap *ArrayAppendPermission[T]) written() bool {
+	return len(aap.buffer) > 0
+}
+
+func (aap *ArrayAppendPermission[T]) apply() {
+	aap.detach()()
+}
+
+func (aap *ArrayAppendPermission[T]) detach() func() {
+	buffer, target := aap.buffer, aap.target
+	aap.buffer = nil
+	return func() {
+		if len(buffer) == 0 {
+			return
+		}
+		target.Set(reflect.AppendSlice(target, reflect.ValueOf(buffer)))
+	}
+}
+
+func (aap ArrayAppendPermission[T]) Type() PermissionType {
+	return AppendPermissionType
+}
+
+// ArraySliceWritePermission grants a command write access to a range of a
+// slice within the source, declared on the view with a range tag:
+//
+//	FirstHalf *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"0:50"`
+//
+// Commands writing to ranges of the same slice that don't overlap are free to
+// run in parallel. Without a range tag the permission covers the entire slice.
+type ArraySliceWritePermission[T any] struct {
+	data  []T
+	start int
+}
+
+// Elements of the slice within the range
+func (aswp ArraySliceWritePermission[T]) Value() []T {
+	return aswp.data
+}
+
+// Index within the source's slice the range starts at
+func (aswp ArraySliceWritePermission[T]) Start() int {
+	return aswp.start
+}
+
+func (aswp *ArraySliceWritePermission[T]) inject(val reflect.Value) error {
+	return aswp.injectRange(val, 0)
+}
+
+func (aswp *ArraySliceWritePermission[T]) injectRange(val reflect.Value, start int) error {
+	data, err := sliceFromValue[T](val)
+	if err != nil {
+		return err
+	}
+	aswp.data = data
+	aswp.start = start
+	return nil
+}
+
+func (aswp *ArraySliceWritePermission[T]) clear() {
+	aswp.data = nil
+	aswp.start = 0
+}
+
+func (aswp ArraySliceWritePermission[T]) Type() PermissionType {
+	return WritePermissionType
+}
+
+// Shared by permissions that overwrite a single field of the source. The
+// value written is only stored in the source once the command has finished.
+type itemWriter[T any] struct {
+	data   T
+	wrote  bool
+	target reflect.Value
+}
+
+func (iw *itemWriter[T]) write(val T) {
+	iw.data = val
+	iw.wrote = true
+}
+
+func (iw *itemWriter[T]) inject(val reflect.Value) error {
+	if !val.CanSet() {
+		return fmt.Errorf("can not populate a write permission with a value that can not be assigned to")
+	}
+	data, err := itemFromValue[T](val)
+	if err != nil {
+		return err
+	}
+	iw.data = data
+	iw.wrote = false
+	iw.target = val
+	return nil
+}
+
+func (iw *itemWriter[T]) clear() {
+	var data T
+	iw.data = data
+	iw.wrote = false
+	iw.target = reflect.Value{}
+}
+
+func (iw *itemWriter[T]) written() bool {
+	return iw.wrote
+}
+
+func (iw *itemWriter[T]) apply() {
+	if !iw.wrote {
+		return
+	}
+	iw.target.Set(reflect.ValueOf(&iw.data).Elem())
+}
+
+// WritePermission grants a command the ability to overwrite a field in the
+// source. The value written is only stored in the source once the command has
+// finished, and only if Write was called. ItemWritePermission is the same
+// permission with methods named after ItemReadPermission's.
 type WritePermission[T any] struct {
-	data    T
-	written bool
+	itemWriter[T]
 }
 
 func (wp WritePermission[T]) Data() T {
@@ -40,10 +204,167 @@ func (wp WritePermission[T]) Data() T {
 }
 
 func (wp *WritePermission[T]) Write(val T) {
-	wp.data = val
-	wp.written = true
+	wp.write(val)
+}
+
+func (wp WritePermission[T]) Type() PermissionType {
+	return WritePermissionType
+}
+
+// ItemWritePermission is the writable counterpart to ItemReadPermission,
+// granting a command the ability to overwrite any non-slice field of the
+// source, such as a string or an entire struct. The value set is only stored
+// in the source once the command has finished, and only if Set was called.
+//
+// It behaves exactly like WritePermission, sharing its implementation, and
+// only differs in naming its methods after ItemReadPermission's so the two
+// can be swapped for one another. WritePermission is kept as is for the views
+// already using it, as generic type aliases aren't available to alias one to
+// the other.
+type ItemWritePermission[T any] struct {
+	itemWriter[T]
+}
+
+// Value of the field, including any value set by the command
+func (iwp ItemWritePermission[T]) Value() T {
+	return iwp.data
+}
+
+func (iwp *ItemWritePermission[T]) Set(val T) {
+	iwp.write(val)
+}
+
+func (iwp ItemWritePermission[T]) Type() PermissionType {
+	return WritePermissionType
+}
+
+// MapWritePermission grants a command the ability to read, set and delete any
+// entry of a map within the source, for when the keys a command needs aren't
+// known ahead of time. Changes made through Set and Delete are only stored in
+// the source's map once the command has finished, creating the map if the
+// source's map is nil.
+type MapWritePermission[K comparable, V any] struct {
+	data    map[K]V
+	changes map[K]*V // nil entries are deletions
+	target  reflect.Value
+}
+
+// Value of the entry, including any changes made by the command
+func (mwp MapWritePermission[K, V]) Get(key K) (V, bool) {
+	if change, ok := mwp.changes[key]; ok {
+		if change == nil {
+			var zero V
+			return zero, false
+		}
+		return *change, true
+	}
+	v, ok := mwp.data[key]
+	return v, ok
+}
+
+// Number of entries in the map, including any changes made by the command
+func (mwp MapWritePermission[K, V]) Len() int {
+	length := len(mwp.data)
+	for key, change := range mwp.changes {
+		_, existed := mwp.data[key]
+		switch {
+		case change == nil && existed:
+			length--
+		case change != nil && !existed:
+			length++
+		}
+	}
+	return length
+}
+
+// Keys of every entry in the map, in no particular order
+func (mwp MapWritePermission[K, V]) Keys() []K {
+	keys := make([]K, 0, len(mwp.data))
+	mwp.Range(func(key K, value V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Calls the function with every entry in the map, including any changes made
+// by the command, in no particular order, stopping early if the function
+// returns false
+func (mwp MapWritePermission[K, V]) Range(f func(key K, value V) bool) {
+	for k, v := range mwp.data {
+		if _, changed := mwp.changes[k]; changed {
+			continue
+		}
+		if !f(k, v) {
+			return
+		}
+	}
+	for k, change := range mwp.changes {
+		if change == nil {
+			continue
+		}
+		if !f(k, *change) {
+			return
+		}
+	}
+}
+
+func (mwp *MapWritePermission[K, V]) Set(key K, value V) {
+	if mwp.changes == nil {
+		mwp.changes = make(map[K]*V)
+	}
+	mwp.changes[key] = &value
+}
+
+func (mwp *MapWritePermission[K, V]) Delete(key K) {
+	if mwp.changes == nil {
+		mwp.changes = make(map[K]*V)
+	}
+	mwp.changes[key] = nil
+}
+
+func (mwp *MapWritePermission[K, V]) inject(val reflect.Value) error {
+	if !val.CanSet() {
+		return fmt.Errorf("can not populate a map write permission with a value that can not be assigned to")
+	}
+	data, err := mapFromValue[K, V](val)
+	if err != nil {
+		return err
+	}
+	mwp.data = data
+	mwp.changes = nil
+	mwp.target = val
+	return nil
+}
+
+func (mwp *MapWritePermission[K, V]) clear() {
+	mwp.data = nil
+	mwp.changes = nil
+	mwp.target = reflect.Value{}
+}
+
+func (mwp *MapWritePermission[K, V]) written() bool {
+	return len(mwp.changes) > 0
+}
+
+func (mwp *MapWritePermission[K, V]) apply() {
+	if len(mwp.changes) == 0 {
+		return
+	}
+
+	if mwp.target.IsNil() {
+		mwp.target.Set(reflect.MakeMap(mwp.target.Type()))
+	}
+	data := mwp.target.Interface().(map[K]V)
+	for key, change := range mwp.changes {
+		if change == nil {
+			delete(data, key)
+			continue
+		}
+		data[key] = *change
+	}
 }
 
-func (awp WritePermission[T]) Type() PermissionType {
+func (mwp MapWritePermission[K, V]) Type() PermissionType {
 	return WritePermissionType
 }
@@ -0,0 +1,561 @@
+package quill_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EliCDavis/quill"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePermission_CommitsWrittenValue(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteStrView struct {
+		Sub struct {
+			Str *quill.WritePermission[string]
+		}
+	}
+
+	type ReadStrView struct {
+		Sub struct {
+			Str *quill.ItemReadPermission[string]
+		}
+	}
+
+	dataSource := quill.NewDataSource(NastyData{
+		Sub: struct {
+			IntArr []int
+			Str    string
+		}{
+			Str: "Before",
+		},
+	})
+	before := ""
+	after := ""
+
+	// ACT ====================================================================
+	dataSource.Run(
+		&quill.ViewCommand[WriteStrView]{
+			Action: func(view *WriteStrView) error {
+				before = view.Sub.Str.Data()
+				view.Sub.Str.Write("After")
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadStrView]{
+			Action: func(view *ReadStrView) error {
+				after = view.Sub.Str.Value()
+				return nil
+			},
+		},
+	)
+	err := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, "Before", before)
+	assert.Equal(t, "After", after)
+}
+
+func TestWritePermission_UnwrittenValueIsUntouched(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteColumnsView struct {
+		Columns struct {
+			Title   *quill.WritePermission[string]
+			Missing *quill.WritePermission[string]
+		}
+	}
+
+	type ReadColumnsView struct {
+		Columns struct {
+			Title *quill.ItemReadPermission[string]
+		}
+	}
+
+	data := struct {
+		Columns map[string]string
+	}{
+		Columns: map[string]string{
+			"Title": "My Taxes",
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+	title := ""
+
+	// ACT ====================================================================
+	dataSource.Run(
+		&quill.ViewCommand[WriteColumnsView]{
+			Action: func(view *WriteColumnsView) error {
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadColumnsView]{
+			Action: func(view *ReadColumnsView) error {
+				title = view.Columns.Title.Value()
+				return nil
+			},
+		},
+	)
+	err := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, "My Taxes", title)
+	assert.Len(t, data.Columns, 1)
+	_, ok := data.Columns["Missing"]
+	assert.False(t, ok)
+}
+
+func TestWritePermission_WritesMapEntry(t *testing.T) {
+	// ARRANGE ================================================================
+	type WriteColumnsView struct {
+		Columns struct {
+			Title *quill.WritePermission[string]
+		}
+	}
+
+	data := struct {
+		Columns map[string]string
+	}{
+		Columns: map[string]string{
+			"Title": "My Taxes",
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+
+	// ACT ====================================================================
+	dataSource.Run(&quill.ViewCommand[WriteColumnsView]{
+		Action: func(view *WriteColumnsView) error {
+			view.Columns.Title.Write("Your Taxes")
+			return nil
+		},
+	})
+	err := dataSource.Close()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, "Your Taxes", data.Columns["Title"])
+}
+
+func TestArraySliceWritePermission_DisjointRangesRunInParallel(t *testing.T) {
+	// ARRANGE ================================================================
+	type FirstHalfView struct {
+		Half *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"0:2"`
+	}
+
+	type SecondHalfView struct {
+		Half *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"2:"`
+	}
+
+	data := &NastyData{
+		FloatArr: []float64{1, 2, 3, 4},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+
+	// Each command waits on the other to start, which only ever happens if
+	// both are running at the same time
+	firstStarted := make(chan struct{})
+	secondStarted := make(chan struct{})
+	rendezvous := func(started, other chan struct{}) error {
+		close(started)
+		select {
+		case <-other:
+			return nil
+		case <-time.After(time.Second):
+			return assert.AnError
+		}
+	}
+	starts := make([]int, 0)
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[FirstHalfView]{
+			Action: func(view *FirstHalfView) error {
+				starts = append(starts, view.Half.Start())
+				for i := range view.Half.Value() {
+					view.Half.Value()[i] *= 10
+				}
+				return rendezvous(firstStarted, secondStarted)
+			},
+		},
+		&quill.ViewCommand[SecondHalfView]{
+			Action: func(view *SecondHalfView) error {
+				for i := range view.Half.Value() {
+					view.Half.Value()[i] *= 100
+				}
+				return rendezvous(secondStarted, firstStarted)
+			},
+		},
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, []int{0}, starts)
+	assert.Equal(t, []float64{10, 20, 300, 400}, data.FloatArr)
+}
+
+func TestArraySliceWritePermission_RangesWithinOneView(t *testing.T) {
+	// ARRANGE ================================================================
+	type OverlappingView struct {
+		Start *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"0:3"`
+		End   *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"2:"`
+	}
+
+	type DisjointView struct {
+		Start *quill.ArraySliceWritePermission[float64] `quill:"FloatArr" range:"0:2"`
+		End   *quill.ArraySliceReadPermission[float64]  `quill:"FloatArr" range:"2:"`
+	}
+
+	data := &NastyData{
+		FloatArr: []float64{1, 2, 3, 4},
+	}
+	dataSource := quill.NewDataSource(data)
+	ran := false
+
+	// ACT ====================================================================
+	overlapping := dataSource.Submit(&quill.ViewCommand[OverlappingView]{
+		Action: func(view *OverlappingView) error {
+			ran = true
+			return nil
+		},
+	})
+	disjoint := dataSource.Submit(&quill.ViewCommand[DisjointView]{
+		Action: func(view *DisjointView) error {
+			view.Start.Value()[0] = view.End.Value().At(1)
+			return nil
+		},
+	})
+	dataSource.Close()
+
+	// ASSERT =================================================================
+	var viewErr quill.ViewError
+	if assert.ErrorAs(t, overlapping.Err(), &viewErr) {
+		assert.Equal(t, ".End", viewErr.Path)
+		assert.Contains(t, viewErr.Reason, "already accessed by another field")
+	}
+	assert.False(t, ran)
+	assert.NoError(t, disjoint.Err())
+	assert.Equal(t, []float64{4, 2, 3, 4}, data.FloatArr)
+}
+
+func TestArraySliceWritePermission_AppendingDoesNotClobberNeighbours(t *testing.T) {
+	// ARRANGE ================================================================
+	type FirstHalfView struct {
+		Half []float64 `quill:"FloatArr" range:"0:2"`
+	}
+	data := NastyData{
+		FloatArr: []float64{1, 2, 3, 4},
+	}
+	view := FirstHalfView{}
+
+	// ACT ====================================================================
+	_, err := quill.PopulateView(&data, &view)
+	view.Half = append(view.Half, 5)
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 5}, view.Half)
+	assert.Equal(t, []float64{1, 2, 3, 4}, data.FloatArr)
+}
+
+func TestMapWritePermission_SetsAndDeletesKeys(t *testing.T) {
+	// ARRANGE ================================================================
+	type CSV struct {
+		Columns map[string][]float64
+	}
+
+	type RenameColumnsView struct {
+		Columns *quill.MapWritePermission[string, []float64]
+	}
+
+	type ReadRenamedView struct {
+		Columns struct {
+			Price *quill.ArrayReadPermission[float64]
+		}
+	}
+
+	data := &CSV{
+		Columns: map[string][]float64{
+			"BasePrice": {10, 20},
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+	read := 0.
+
+	// ACT ====================================================================
+	dataSource.Run(
+		&quill.ViewCommand[RenameColumnsView]{
+			Action: func(view *RenameColumnsView) error {
+				for _, key := range view.Columns.Keys() {
+					column, _ := view.Columns.Get(key)
+					view.Columns.Delete(key)
+					view.Columns.Set("Price", column)
+				}
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadRenamedView]{
+			Action: func(view *ReadRenamedView) error {
+				read = view.Columns.Price.Value().At(1)
+				return nil
+			},
+		},
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, 20., read)
+	assert.Equal(t, map[string][]float64{"Price": {10, 20}}, data.Columns)
+}
+
+func TestMapWritePermission_NilMapIsAllocated(t *testing.T) {
+	// ARRANGE ================================================================
+	type Counts struct {
+		ByName map[string]int
+	}
+
+	type CountView struct {
+		ByName *quill.MapWritePermission[string, int]
+	}
+
+	data := &Counts{}
+	dataSource := quill.NewDataSource(data)
+
+	// ACT ====================================================================
+	err := dataSource.Submit(&quill.ViewCommand[CountView]{
+		Action: func(view *CountView) error {
+			view.ByName.Set("a", 1)
+			return nil
+		},
+	}).Wait()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, map[string]int{"a": 1}, data.ByName)
+}
+
+func TestItemWritePermission_WritesScalarField(t *testing.T) {
+	// ARRANGE ================================================================
+	type RetitleView struct {
+		Title *quill.ItemWritePermission[string]
+	}
+
+	type ReadTitleView struct {
+		Title *quill.ItemReadPermission[string]
+	}
+
+	data := &CSVData{Title: "Draft"}
+	dataSource := quill.NewDataSource(data)
+	before := ""
+	after := ""
+
+	// ACT ====================================================================
+	dataSource.Run(
+		&quill.ViewCommand[RetitleView]{
+			Action: func(view *RetitleView) error {
+				before = view.Title.Value()
+				view.Title.Set("Final")
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadTitleView]{
+			Action: func(view *ReadTitleView) error {
+				after = view.Title.Value()
+				return nil
+			},
+		},
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, "Draft", before)
+	assert.Equal(t, "Final", after)
+	assert.Equal(t, "Final", data.Title)
+}
+
+func TestItemWritePermission_WritesStructField(t *testing.T) {
+	// ARRANGE ================================================================
+	type Sub = struct {
+		IntArr []int
+		Str    string
+	}
+
+	type ReplaceSubView struct {
+		Sub *quill.ItemWritePermission[Sub]
+	}
+
+	type ReadIntArrView struct {
+		Sub struct {
+			IntArr *quill.ArrayReadPermission[int]
+		}
+	}
+
+	data := &NastyData{
+		Sub: Sub{IntArr: []int{1}, Str: "old"},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	release := make(chan struct{})
+	read := 0
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		&quill.ViewCommand[ReplaceSubView]{
+			Action: func(view *ReplaceSubView) error {
+				<-release
+				view.Sub.Set(Sub{IntArr: []int{7, 8}, Str: "new"})
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadIntArrView]{
+			Action: func(view *ReadIntArrView) error {
+				read = view.Sub.IntArr.Value().At(1)
+				return nil
+			},
+		},
+	)
+	close(release)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, 8, read)
+	assert.Equal(t, Sub{IntArr: []int{7, 8}, Str: "new"}, data.Sub)
+}
+
+func TestArrayAppendPermission_AppendersShareSliceInSubmissionOrder(t *testing.T) {
+	// ARRANGE ================================================================
+	type AppendView struct {
+		FloatArr *quill.ArrayAppendPermission[float64]
+	}
+
+	type ReadView struct {
+		FloatArr *quill.ArrayReadPermission[float64]
+	}
+
+	data := &NastyData{
+		FloatArr: []float64{0},
+	}
+	dataSource := quill.NewDataSource(data, quill.WithPoolSize(4))
+	secondFinished := make(chan struct{})
+	readLen := 0
+
+	// ACT ====================================================================
+	futures := dataSource.Run(
+		// Doesn't finish until the second appender has, which only ever
+		// happens if both are running at the same time
+		&quill.ViewCommand[AppendView]{
+			Action: func(view *AppendView) error {
+				select {
+				case <-secondFinished:
+				case <-time.After(time.Second):
+					return assert.AnError
+				}
+				view.FloatArr.Append(1, 2)
+				return nil
+			},
+		},
+		&quill.ViewCommand[AppendView]{
+			Action: func(view *AppendView) error {
+				view.FloatArr.Append(3)
+				close(secondFinished)
+				return nil
+			},
+		},
+		&quill.ViewCommand[ReadView]{
+			Action: func(view *ReadView) error {
+				readLen = view.FloatArr.Value().Len()
+				return nil
+			},
+		},
+	)
+
+	// ASSERT =================================================================
+	assert.NoError(t, quill.WaitAll(futures...))
+	assert.NoError(t, dataSource.Close())
+	assert.Equal(t, 4, readLen)
+	assert.Equal(t, []float64{0, 1, 2, 3}, data.FloatArr)
+}
+
+func TestArrayAppendPermission_PopulateView(t *testing.T) {
+	// ARRANGE ================================================================
+	type AppendView struct {
+		Sub struct {
+			IntArr *quill.ArrayAppendPermission[int]
+		}
+	}
+	data := NastyData{}
+	view := AppendView{}
+
+	// ACT ====================================================================
+	changes, err := quill.PopulateView(&data, &view)
+	view.Sub.IntArr.Append(4, 5)
+	appended := view.Sub.IntArr.Appended()
+	changes.Apply()
+
+	// ASSERT =================================================================
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 5}, appended)
+	assert.Equal(t, []int{4, 5}, data.Sub.IntArr)
+}
+
+func TestArrayAppendPermission_MapEntryRejected(t *testing.T) {
+	// ARRANGE ================================================================
+	type AppendColumnView struct {
+		Price *quill.ArrayAppendPermission[float64] `quill:"Columns.Price"`
+	}
+	data := CSVData{
+		Columns: map[string][]float64{"Price": {1}},
+	}
+	view := AppendColumnView{}
+
+	// ACT ====================================================================
+	_, err := quill.PopulateView(&data, &view)
+
+	// ASSERT =================================================================
+	var viewErr quill.ViewError
+	if assert.ErrorAs(t, err, &viewErr) {
+		assert.Equal(t, ".Price", viewErr.Path)
+	}
+}
+
+func TestMapWritePermission_PanickingCommandLeavesMapUnchanged(t *testing.T) {
+	// ARRANGE ================================================================
+	type CSV struct {
+		Columns map[string][]float64
+	}
+
+	type RenameColumnsView struct {
+		Columns *quill.MapWritePermission[string, []float64]
+	}
+
+	data := &CSV{
+		Columns: map[string][]float64{
+			"BasePrice": {10, 20},
+		},
+	}
+	dataSource := quill.NewDataSource(data)
+	seen := map[string][]float64{}
+
+	// ACT ====================================================================
+	err := dataSource.Submit(&quill.ViewCommand[RenameColumnsView]{
+		Action: func(view *RenameColumnsView) error {
+			column, _ := view.Columns.Get("BasePrice")
+			view.Columns.Delete("BasePrice")
+			view.Columns.Set("Price", column)
+			view.Columns.Range(func(key string, value []float64) bool {
+				seen[key] = value
+				return true
+			})
+			panic("oh no")
+		},
+	}).Wait()
+	dataSource.Close()
+
+	// ASSERT =================================================================
+	var panicErr quill.PanicError
+	assert.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, map[string][]float64{"Price": {10, 20}}, seen, "command should see its own changes")
+	assert.Equal(t, map[string][]float64{"BasePrice": {10, 20}}, data.Columns)
+}